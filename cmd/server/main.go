@@ -1,10 +1,23 @@
 package main
 
 import (
+	"flag"
+
+	"github.com/WindyDante/toolpost/internal/config"
 	"github.com/WindyDante/toolpost/internal/server"
 )
 
 func main() {
+	configDir := flag.String("config", "", "配置文件目录,默认为 ./config,也可以通过 TOOLPOST_CONFIG 环境变量指定")
+	flag.Parse()
+	config.SetConfigDir(*configDir)
+
+	// toolpost rotate-key 轮换文件加密的主密钥
+	if flag.Arg(0) == "rotate-key" {
+		server.RotateMasterKey()
+		return
+	}
+
 	s := server.New() // Create a new server instance
 
 	s.Init() // use server instance
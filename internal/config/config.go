@@ -1,47 +1,145 @@
 package config
 
-import (
-	"path/filepath"
-
-	model "github.com/WindyDante/toolpost/internal/model/common"
-	"github.com/spf13/viper"
-)
-
 var Config ConfigUtil
 
+type ServerTLSConfig struct {
+	Enabled        bool   `yaml:"enabled"`        // 是否使用HTTPS
+	CertFile       string `yaml:"certFile"`       // 证书文件,可包含中间证书
+	KeyFile        string `yaml:"keyFile"`        // 私钥文件
+	ReloadInterval int64  `yaml:"reloadInterval"` // 检查证书文件是否更新的间隔(秒),0表示不重新加载
+}
+
 type ServerConfig struct {
 	Host string `yaml:"host"`
 	Port string `yaml:"port"`
 	Mode string `yaml:"mode"`
+
+	CorsOrigins []string `yaml:"corsOrigins"` // 允许跨域访问的来源,包含 * 时允许所有来源,修改后无需重启
+	LogLevel    string   `yaml:"logLevel"`    // 日志级别,debug、info、warn 或 error,修改后无需重启
+
+	TrustedProxies  []string `yaml:"trustedProxies"`  // 信任的反向代理地址或网段,只有来自这些地址的请求才使用X-Forwarded-For中的客户端IP
+	TrustedPlatform string   `yaml:"trustedPlatform"` // 反向代理传递客户端IP的请求头,如 X-Real-IP,设置后直接信任该请求头
+
+	Network    string          `yaml:"network"`    // 监听方式,tcp 或 unix
+	Socket     string          `yaml:"socket"`     // network为unix时的socket文件路径
+	SocketMode string          `yaml:"socketMode"` // socket文件的权限,八进制,如 0660
+	TLS        ServerTLSConfig `yaml:"tls"`
+	H2C        bool            `yaml:"h2c"` // 未启用TLS时是否支持HTTP/2明文连接,用于反向代理通过h2c转发
+
+	ReadHeaderTimeout int64 `yaml:"readHeaderTimeout"` // 读取请求头的超时时间(秒)
+	ReadTimeout       int64 `yaml:"readTimeout"`       // 读取整个请求的超时时间(秒),0表示不限制,大文件上传时需要足够长
+	WriteTimeout      int64 `yaml:"writeTimeout"`      // 写入响应的超时时间(秒),0表示不限制,大文件下载时需要足够长
+	IdleTimeout       int64 `yaml:"idleTimeout"`       // keep-alive连接的空闲超时时间(秒)
+	ShutdownTimeout   int64 `yaml:"shutdownTimeout"`   // 关闭时等待进行中的请求结束的时间(秒)
 }
 
 type DatabaseConfig struct {
-	Type string `yaml:"type"`
+	Type string `yaml:"type"` // sqlite、postgres 或 mysql
+	Path string `yaml:"path"` // sqlite数据库文件路径,:memory: 表示内存数据库
+	DSN  string `yaml:"dsn"`  // postgres和mysql的连接字符串
+
+	MaxOpenConns    int   `yaml:"maxOpenConns"`    // 最大连接数,0表示不限制
+	MaxIdleConns    int   `yaml:"maxIdleConns"`    // 最大空闲连接数
+	ConnMaxLifetime int64 `yaml:"connMaxLifetime"` // 连接的最长使用时间(秒),0表示不限制
+	ConnMaxIdleTime int64 `yaml:"connMaxIdleTime"` // 连接的最长空闲时间(秒),0表示不限制
+}
+
+type LocalStorageConfig struct {
 	Path string `yaml:"path"`
 }
 
-// 创建yaml解析结构体
+type S3StorageConfig struct {
+	Endpoint      string `yaml:"endpoint"`
+	AccessKey     string `yaml:"accessKey"`
+	SecretKey     string `yaml:"secretKey"`
+	Bucket        string `yaml:"bucket"`
+	Region        string `yaml:"region"`
+	UseSSL        bool   `yaml:"useSSL"`
+	PresignExpire int64  `yaml:"presignExpire"` // 预签名下载链接有效期(秒),0表示不使用预签名链接
+}
+
+type StorageConfig struct {
+	Type  string             `yaml:"type"`
+	Local LocalStorageConfig `yaml:"local"`
+	S3    S3StorageConfig    `yaml:"s3"`
+}
+
+type EncryptionConfig struct {
+	Enabled    bool     `yaml:"enabled"`    // 是否加密新写入的文件
+	MasterKeys []string `yaml:"masterKeys"` // base64编码的32字节主密钥,第一个用于加密,其余仅用于解密
+	KeyFile    string   `yaml:"keyFile"`    // 未配置主密钥时使用的密钥文件,不存在时自动生成
+	ChunkSize  int      `yaml:"chunkSize"`  // 每个加密分块的明文大小(字节)
+}
+
+type UploadConfig struct {
+	MaxSize  int64  `yaml:"maxSize"`  // 单个文件大小上限(字节)
+	TusPath  string `yaml:"tusPath"`  // 断点续传临时目录
+	MaxFiles int    `yaml:"maxFiles"` // 一次上传的文件数量上限
+}
+
+type ReaperConfig struct {
+	Interval    int64 `yaml:"interval"`    // 扫描间隔(秒),0表示暂停清理
+	GracePeriod int64 `yaml:"gracePeriod"` // 过期后保留的时间(秒)
+	TusExpire   int64 `yaml:"tusExpire"`   // 断点续传任务最后一次上传后保留的时间(秒),0表示不清理
+}
+
+type SecurityConfig struct {
+	SigningSecrets    []string `yaml:"signingSecrets"`    // 下载链接签名密钥,第一个用于签名,其余仅用于校验
+	DownloadUrlExpire int64    `yaml:"downloadUrlExpire"` // 下载链接有效期(秒)
+}
+
+type LimitConfig struct {
+	Rate  float64 `yaml:"rate"`  // 每秒补充的请求数
+	Burst int     `yaml:"burst"` // 允许的突发请求数
+}
+
+type LockoutConfig struct {
+	Threshold   int   `yaml:"threshold"`   // 统计窗口内失败多少次后锁定,0表示不锁定
+	Window      int64 `yaml:"window"`      // 失败次数的统计窗口(秒)
+	Duration    int64 `yaml:"duration"`    // 首次锁定的时长(秒),之后每次翻倍
+	MaxDuration int64 `yaml:"maxDuration"` // 锁定时长上限(秒)
+}
+
+type RateLimitConfig struct {
+	IP      LimitConfig   `yaml:"ip"`
+	Code    LimitConfig   `yaml:"code"`
+	Lockout LockoutConfig `yaml:"lockout"`
+}
+
+type CustomCodeConfig struct {
+	MinLength int    `yaml:"minLength"` // 自定义访问码最小长度
+	MaxLength int    `yaml:"maxLength"` // 自定义访问码最大长度
+	Pattern   string `yaml:"pattern"`   // 自定义访问码需要匹配的正则表达式
+}
+
+type CodeConfig struct {
+	Type      string           `yaml:"type"`      // numeric、base32、words 或 custom
+	Length    int              `yaml:"length"`    // 访问码长度,words类型为单词个数
+	Alphabet  string           `yaml:"alphabet"`  // custom类型使用的字符集
+	Words     []string         `yaml:"words"`     // words类型使用的词表,为空时使用内置词表
+	Separator string           `yaml:"separator"` // words类型的单词分隔符
+	Retries   int              `yaml:"retries"`   // 访问码冲突时的最大重试次数
+	Custom    CustomCodeConfig `yaml:"custom"`
+}
+
+type PreviewConfig struct {
+	ThumbnailSize  int    `yaml:"thumbnailSize"`  // 缩略图最长边的像素数
+	MaxImageSize   int64  `yaml:"maxImageSize"`   // 生成缩略图的图片大小上限(字节)
+	MaxImagePixels int64  `yaml:"maxImagePixels"` // 生成缩略图的图片像素数上限
+	MaxTextSize    int    `yaml:"maxTextSize"`    // 文本预览最多返回的字节数
+	CachePath      string `yaml:"cachePath"`      // 缩略图缓存目录
+}
+
+// 创建yaml解析结构体,每个字段对应config目录下的一个配置文件
 type ConfigUtil struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-}
-
-func loadConfigFile(filename string, target any) {
-	v := viper.New()
-	v.SetConfigFile(filepath.Join(model.CONFIG_FILE_PREFIX, filename))
-	v.SetConfigType(model.CONFIG_TYPE_YAML)
-	err := v.ReadInConfig()
-	if err != nil {
-		panic(model.READ_CONFIG_PANIC + ": " + err.Error())
-	}
-	if err = v.Unmarshal(target); err != nil {
-		panic(model.READ_CONFIG_PANIC + ": " + err.Error())
-	}
-}
-
-func LoadConfig() {
-	// 加载服务器配置
-	loadConfigFile("server.yaml", &Config.Server)
-	// 加载数据库配置
-	loadConfigFile("database.yaml", &Config.Database)
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Storage    StorageConfig
+	Upload     UploadConfig
+	Reaper     ReaperConfig
+	Security   SecurityConfig
+	RateLimit  RateLimitConfig
+	Code       CodeConfig
+	Preview    PreviewConfig
+	Encryption EncryptionConfig
 }
@@ -0,0 +1,90 @@
+package config
+
+// defaultConfig 所有配置项的默认值,与config目录下随项目提供的配置文件一致
+// 配置文件不存在或缺少某一项时使用默认值
+func defaultConfig() ConfigUtil {
+	return ConfigUtil{
+		Server: ServerConfig{
+			Host:              "0.0.0.0",
+			Port:              "6332",
+			Mode:              "release",
+			CorsOrigins:       []string{"*"},
+			LogLevel:          "info",
+			TrustedProxies:    []string{},
+			ReadHeaderTimeout: 10,
+			IdleTimeout:       120,
+			ShutdownTimeout:   30,
+			Network:           "tcp",
+			Socket:            "./data/toolpost.sock",
+			SocketMode:        "0660",
+			TLS: ServerTLSConfig{
+				ReloadInterval: 60,
+			},
+		},
+		Database: DatabaseConfig{
+			Type:            "sqlite",
+			Path:            "data/share.db",
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 1800,
+			ConnMaxIdleTime: 600,
+		},
+		Storage: StorageConfig{
+			Type: "local",
+			Local: LocalStorageConfig{
+				Path: "./share",
+			},
+			S3: S3StorageConfig{
+				PresignExpire: 600,
+			},
+		},
+		Upload: UploadConfig{
+			MaxSize:  500 * 1024 * 1024,
+			TusPath:  "./data/tus",
+			MaxFiles: 100,
+		},
+		Reaper: ReaperConfig{
+			Interval:    600,
+			GracePeriod: 300,
+			TusExpire:   86400,
+		},
+		Security: SecurityConfig{
+			SigningSecrets:    []string{},
+			DownloadUrlExpire: 3600,
+		},
+		RateLimit: RateLimitConfig{
+			IP:   LimitConfig{Rate: 1, Burst: 30},
+			Code: LimitConfig{Rate: 0.5, Burst: 20},
+			Lockout: LockoutConfig{
+				Threshold:   10,
+				Window:      600,
+				Duration:    60,
+				MaxDuration: 3600,
+			},
+		},
+		Code: CodeConfig{
+			Type:      "numeric",
+			Length:    6,
+			Words:     []string{},
+			Separator: "-",
+			Retries:   5,
+			Custom: CustomCodeConfig{
+				MinLength: 4,
+				MaxLength: 32,
+				Pattern:   "^[A-Za-z0-9_-]+$",
+			},
+		},
+		Preview: PreviewConfig{
+			ThumbnailSize:  320,
+			MaxImageSize:   20 * 1024 * 1024,
+			MaxImagePixels: 40000000,
+			MaxTextSize:    64 * 1024,
+			CachePath:      "./data/preview",
+		},
+		Encryption: EncryptionConfig{
+			MasterKeys: []string{},
+			KeyFile:    "./data/master.key",
+			ChunkSize:  64 * 1024,
+		},
+	}
+}
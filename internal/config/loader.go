@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	model "github.com/WindyDante/toolpost/internal/model/common"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configDir 配置文件目录,通过 --config 参数或 TOOLPOST_CONFIG 环境变量指定
+var configDir string
+
+// configFiles 每个配置文件对应的配置项,文件不存在时使用默认值
+var configFiles = []struct {
+	section string
+	file    string
+}{
+	{"server", "server.yaml"},
+	{"database", "database.yaml"},
+	{"storage", "storage.yaml"},
+	{"upload", "upload.yaml"},
+	{"reaper", "reaper.yaml"},
+	{"security", "security.yaml"},
+	{"ratelimit", "ratelimit.yaml"},
+	{"code", "code.yaml"},
+	{"preview", "preview.yaml"},
+	{"encryption", "encryption.yaml"},
+}
+
+// SetConfigDir 指定配置文件目录,为空时使用 TOOLPOST_CONFIG 环境变量,都未指定时使用 ./config
+func SetConfigDir(dir string) {
+	configDir = dir
+}
+
+// Dir 当前使用的配置文件目录
+func Dir() string {
+	if configDir != "" {
+		return configDir
+	}
+	if dir := os.Getenv(model.CONFIG_DIR_ENV); dir != "" {
+		return dir
+	}
+	return model.CONFIG_FILE_PREFIX
+}
+
+// LoadConfig 加载配置,优先级从高到低为环境变量、配置文件、默认值
+// 环境变量为 TOOLPOST_ 加上以下划线连接的配置项,如 TOOLPOST_SERVER_PORT、TOOLPOST_STORAGE_S3_ACCESSKEY
+// 列表类型的配置项在环境变量中以逗号分隔
+func LoadConfig() {
+	loaded, err := Load(Dir())
+	if err != nil {
+		panic(err.Error())
+	}
+	Config = loaded
+	snapshot := loaded
+	current.Store(&snapshot)
+}
+
+// Load 从指定目录加载并校验配置,校验失败时返回所有无效的配置项
+func Load(dir string) (ConfigUtil, error) {
+	v := viper.New()
+	setDefaults(v, "", reflect.ValueOf(defaultConfig()))
+
+	for _, configFile := range configFiles {
+		values, err := readConfigFile(filepath.Join(dir, configFile.file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return ConfigUtil{}, errors.New(model.READ_CONFIG_PANIC + ": " + configFile.file + ": " + err.Error())
+		}
+		if err := v.MergeConfigMap(map[string]any{configFile.section: values}); err != nil {
+			return ConfigUtil{}, errors.New(model.READ_CONFIG_PANIC + ": " + configFile.file + ": " + err.Error())
+		}
+	}
+
+	v.SetEnvPrefix(model.CONFIG_ENV_PREFIX)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	var loaded ConfigUtil
+	if err := v.Unmarshal(&loaded, func(decoderConfig *mapstructure.DecoderConfig) {
+		decoderConfig.TagName = model.CONFIG_TYPE_YAML
+	}); err != nil {
+		return ConfigUtil{}, errors.New(model.READ_CONFIG_PANIC + ": " + err.Error())
+	}
+	if err := loaded.Validate(); err != nil {
+		return ConfigUtil{}, errors.New(model.INVALID_CONFIG_PANIC + ":\n" + err.Error())
+	}
+	return loaded, nil
+}
+
+// readConfigFile 读取一个配置文件,空文件返回空的配置
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// setDefaults 将默认配置中的每个字段注册为默认值,注册后的配置项才能被环境变量覆盖
+func setDefaults(v *viper.Viper, prefix string, value reflect.Value) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		key := configKey(field)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if field.Type.Kind() == reflect.Struct {
+			setDefaults(v, key, value.Field(i))
+			continue
+		}
+		v.SetDefault(key, value.Field(i).Interface())
+	}
+}
+
+// configKey 配置项在viper中的名称,viper的配置项不区分大小写
+func configKey(field reflect.StructField) string {
+	return strings.ToLower(fieldKey(field))
+}
+
+// fieldKey 配置项的名称,与yaml标签一致,没有标签时使用小写的字段名
+func fieldKey(field reflect.StructField) string {
+	if tag, _, _ := strings.Cut(field.Tag.Get(model.CONFIG_TYPE_YAML), ","); tag != "" {
+		return tag
+	}
+	return strings.ToLower(field.Name)
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig 在 dir 中写入配置文件
+func writeConfig(t *testing.T, dir, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	loaded, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, defaultConfig()) {
+		t.Errorf("Load(empty dir) differs from defaults:\n%+v\n%+v", loaded, defaultConfig())
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "server.yaml", "port: \"9000\"\ncorsOrigins:\n  - https://a.example\n  - https://b.example\n")
+	writeConfig(t, dir, "upload.yaml", "maxSize: 1024\n")
+	// 空文件使用默认值
+	writeConfig(t, dir, "reaper.yaml", "")
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := defaultConfig()
+	if loaded.Server.Port != "9000" {
+		t.Errorf("server.port = %q, want 9000", loaded.Server.Port)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(loaded.Server.CorsOrigins, want) {
+		t.Errorf("server.corsOrigins = %q, want %q", loaded.Server.CorsOrigins, want)
+	}
+	if loaded.Upload.MaxSize != 1024 {
+		t.Errorf("upload.maxSize = %d, want 1024", loaded.Upload.MaxSize)
+	}
+	// 文件中未设置的配置项保留默认值
+	if loaded.Server.Mode != defaults.Server.Mode || loaded.Upload.TusPath != defaults.Upload.TusPath {
+		t.Errorf("unset keys lost their defaults: mode=%q tusPath=%q", loaded.Server.Mode, loaded.Upload.TusPath)
+	}
+	if !reflect.DeepEqual(loaded.Reaper, defaults.Reaper) {
+		t.Errorf("reaper from empty file = %+v, want %+v", loaded.Reaper, defaults.Reaper)
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "server.yaml", "port: \"9000\"\ncorsOrigins:\n  - https://file.example\n")
+
+	t.Setenv("TOOLPOST_SERVER_PORT", "9100")
+	t.Setenv("TOOLPOST_UPLOAD_MAXSIZE", "2048")
+	t.Setenv("TOOLPOST_STORAGE_S3_ACCESSKEY", "access")
+	t.Setenv("TOOLPOST_ENCRYPTION_ENABLED", "true")
+	// 列表类型的配置项以逗号分隔
+	t.Setenv("TOOLPOST_SERVER_CORSORIGINS", "https://a.example,https://b.example")
+	t.Setenv("TOOLPOST_SERVER_TRUSTEDPROXIES", "10.0.0.0/8,127.0.0.1")
+	t.Setenv("TOOLPOST_SECURITY_SIGNINGSECRETS", "new,old")
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Server.Port != "9100" {
+		t.Errorf("server.port = %q, want env value 9100", loaded.Server.Port)
+	}
+	if loaded.Upload.MaxSize != 2048 {
+		t.Errorf("upload.maxSize = %d, want 2048", loaded.Upload.MaxSize)
+	}
+	if loaded.Storage.S3.AccessKey != "access" {
+		t.Errorf("storage.s3.accessKey = %q, want access", loaded.Storage.S3.AccessKey)
+	}
+	if !loaded.Encryption.Enabled {
+		t.Error("encryption.enabled not overridden")
+	}
+	lists := []struct {
+		key  string
+		got  []string
+		want []string
+	}{
+		{key: "server.corsOrigins", got: loaded.Server.CorsOrigins, want: []string{"https://a.example", "https://b.example"}},
+		{key: "server.trustedProxies", got: loaded.Server.TrustedProxies, want: []string{"10.0.0.0/8", "127.0.0.1"}},
+		{key: "security.signingSecrets", got: loaded.Security.SigningSecrets, want: []string{"new", "old"}},
+	}
+	for _, list := range lists {
+		if !reflect.DeepEqual(list.got, list.want) {
+			t.Errorf("%s = %q, want %q", list.key, list.got, list.want)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "server.yaml", "port: \"70000\"\nlogLevel: verbose\ntrustedProxies:\n  - not-an-ip\n")
+	writeConfig(t, dir, "upload.yaml", "maxSize: 0\n")
+	writeConfig(t, dir, "code.yaml", "custom:\n  pattern: \"[\"\n")
+
+	_, err := Load(dir)
+	if err == nil {
+		t.Fatal("Load accepted an invalid config")
+	}
+	// 一次返回所有无效的配置项
+	for _, key := range []string{"server.port", "server.logLevel", "server.trustedProxies[0]", "upload.maxSize", "code.custom.pattern"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s:\n%v", key, err)
+		}
+	}
+
+	writeConfig(t, dir, "server.yaml", "port: [\n")
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "server.yaml") {
+		t.Errorf("Load with malformed yaml = %v, want error naming server.yaml", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(c *ConfigUtil)
+		key       string
+	}{
+		{name: "unix without socket", configure: func(c *ConfigUtil) { c.Server.Network = "unix"; c.Server.Socket = "" }, key: "server.socket"},
+		{name: "bad socket mode", configure: func(c *ConfigUtil) {
+			c.Server.Network = "unix"
+			c.Server.Socket = "/tmp/a.sock"
+			c.Server.SocketMode = "rw"
+		}, key: "server.socketMode"},
+		{name: "tls without cert", configure: func(c *ConfigUtil) { c.Server.TLS.Enabled = true }, key: "server.tls.certFile"},
+		{name: "mysql without dsn", configure: func(c *ConfigUtil) { c.Database.Type = "mysql" }, key: "database.dsn"},
+		{name: "s3 without bucket", configure: func(c *ConfigUtil) { c.Storage.Type = "s3"; c.Storage.S3.Endpoint = "s3" }, key: "storage.s3.bucket"},
+		{name: "negative rate", configure: func(c *ConfigUtil) { c.RateLimit.IP.Rate = -1 }, key: "ratelimit.ip.rate"},
+		{name: "custom code range", configure: func(c *ConfigUtil) { c.Code.Custom.MaxLength = 1 }, key: "code.custom.maxLength"},
+		{name: "short master key", configure: func(c *ConfigUtil) { c.Encryption.MasterKeys = []string{"c2hvcnQ="} }, key: "encryption.masterKeys[0]"},
+		{name: "encryption without key file", configure: func(c *ConfigUtil) {
+			c.Encryption.Enabled = true
+			c.Encryption.KeyFile = ""
+		}, key: "encryption.keyFile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			tt.configure(&c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("Validate() = %v, want error for %s", err, tt.key)
+			}
+		})
+	}
+
+	c := defaultConfig()
+	if err := c.Validate(); err != nil {
+		t.Errorf("defaults are invalid: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const RELOAD_DELAY = 500 * time.Millisecond // 配置文件变化后等待的时间,编辑器保存时可能触发多次事件
+
+var (
+	current   atomic.Pointer[ConfigUtil] // 当前生效的配置快照,热加载时整体替换
+	reloadMu  sync.Mutex
+	listeners []func(c *ConfigUtil)
+)
+
+// configChange 一个配置项的变化
+type configChange struct {
+	key string
+	old string
+	new string
+}
+
+// Current 当前生效的配置快照,包含热加载后的限额、跨域来源、日志级别和清理间隔
+// 快照在热加载时整体替换,调用方不能修改返回的配置,每次使用时重新获取
+func Current() *ConfigUtil {
+	if snapshot := current.Load(); snapshot != nil {
+		return snapshot
+	}
+	return &Config
+}
+
+// OnReload 注册热加载后的回调,回调参数为新的配置快照
+func OnReload(fn func(c *ConfigUtil)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// Watch 监听配置文件目录,文件变化后重新加载配置,返回停止监听的函数
+// 监听目录而不是单个文件,编辑器通过重命名保存和Kubernetes替换ConfigMap时也能收到事件
+func Watch() (func() error, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(Dir()); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				if timer == nil {
+					timer = time.AfterFunc(RELOAD_DELAY, Reload)
+				} else {
+					timer.Reset(RELOAD_DELAY)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logUtil.Logger.Warn("监听配置文件失败", zap.Error(err))
+			}
+		}
+	}()
+	return watcher.Close, nil
+}
+
+// Reload 重新加载配置文件,只有可热加载的配置项立即生效,其余配置项需要重启服务
+// 新的配置校验失败时继续使用当前配置
+func Reload() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	loaded, err := Load(Dir())
+	if err != nil {
+		logUtil.Logger.Error("重新加载配置失败,继续使用当前配置", zap.Error(err))
+		return
+	}
+
+	old := Current()
+	next := *old
+	next.applyReloadable(&loaded)
+
+	if pending := diffConfig(&next, &loaded); len(pending) > 0 {
+		keys := make([]string, 0, len(pending))
+		for _, change := range pending {
+			keys = append(keys, change.key)
+		}
+		logUtil.Logger.Warn("以下配置项需要重启服务后生效", zap.Strings("keys", keys))
+	}
+
+	changes := diffConfig(old, &next)
+	if len(changes) == 0 {
+		return
+	}
+	for _, change := range changes {
+		logUtil.Logger.Info("配置已更新",
+			zap.String("key", change.key),
+			zap.String("old", change.old),
+			zap.String("new", change.new))
+	}
+
+	current.Store(&next)
+	for _, fn := range listeners {
+		fn(&next)
+	}
+}
+
+// applyReloadable 复制可以在运行时生效的配置项
+func (c *ConfigUtil) applyReloadable(loaded *ConfigUtil) {
+	c.Server.CorsOrigins = loaded.Server.CorsOrigins
+	c.Server.LogLevel = loaded.Server.LogLevel
+	c.Upload.MaxSize = loaded.Upload.MaxSize
+	c.Upload.MaxFiles = loaded.Upload.MaxFiles
+	c.Reaper = loaded.Reaper
+	c.RateLimit = loaded.RateLimit
+}
+
+// diffConfig 比较两份配置,按字段顺序返回值不同的配置项
+func diffConfig(old, next *ConfigUtil) []configChange {
+	_, oldValues := flatten(reflect.ValueOf(*old))
+	keys, nextValues := flatten(reflect.ValueOf(*next))
+
+	var changes []configChange
+	for _, key := range keys {
+		if oldValues[key] != nextValues[key] {
+			changes = append(changes, configChange{key: key, old: oldValues[key], new: nextValues[key]})
+		}
+	}
+	return changes
+}
+
+// flatten 将配置展开为以点连接的配置项,返回按字段顺序排列的配置项名称和对应的值
+func flatten(value reflect.Value) ([]string, map[string]string) {
+	var keys []string
+	values := map[string]string{}
+	var walk func(prefix string, value reflect.Value)
+	walk = func(prefix string, value reflect.Value) {
+		valueType := value.Type()
+		for i := 0; i < valueType.NumField(); i++ {
+			field := valueType.Field(i)
+			key := fieldKey(field)
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(key, value.Field(i))
+				continue
+			}
+			keys = append(keys, key)
+			values[key] = fmt.Sprint(value.Field(i).Interface())
+		}
+	}
+	walk("", value)
+	return keys, values
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+)
+
+// setupReload 使用临时目录作为配置目录并加载初始配置,测试结束后恢复全局状态
+func setupReload(t *testing.T, files map[string]string) string {
+	t.Helper()
+	logUtil.InitLogger()
+
+	dir := t.TempDir()
+	for file, content := range files {
+		writeConfig(t, dir, file, content)
+	}
+
+	oldDir, oldConfig, oldCurrent := configDir, Config, current.Load()
+	reloadMu.Lock()
+	oldListeners := listeners
+	listeners = nil
+	reloadMu.Unlock()
+	t.Cleanup(func() {
+		configDir, Config = oldDir, oldConfig
+		current.Store(oldCurrent)
+		reloadMu.Lock()
+		listeners = oldListeners
+		reloadMu.Unlock()
+	})
+
+	SetConfigDir(dir)
+	LoadConfig()
+	return dir
+}
+
+func TestReloadAppliesOnlyReloadableKeys(t *testing.T) {
+	dir := setupReload(t, map[string]string{
+		"server.yaml": "port: \"9000\"\nlogLevel: info\ncorsOrigins:\n  - https://a.example\n",
+		"upload.yaml": "maxSize: 1024\nmaxFiles: 5\ntusPath: ./tus\n",
+	})
+	before := *Current()
+
+	var notified []*ConfigUtil
+	OnReload(func(c *ConfigUtil) { notified = append(notified, c) })
+
+	writeConfig(t, dir, "server.yaml", "port: \"9100\"\nlogLevel: debug\ncorsOrigins:\n  - https://b.example\n")
+	writeConfig(t, dir, "upload.yaml", "maxSize: 2048\nmaxFiles: 10\ntusPath: ./other\n")
+	writeConfig(t, dir, "reaper.yaml", "interval: 60\ntusExpire: 0\n")
+	writeConfig(t, dir, "ratelimit.yaml", "ip:\n  rate: 5\n  burst: 50\n")
+	writeConfig(t, dir, "database.yaml", "path: ./other.db\n")
+	Reload()
+
+	next := Current()
+	if len(notified) != 1 || notified[0] != next {
+		t.Fatalf("listeners notified %d times, want once with the new snapshot", len(notified))
+	}
+
+	// 可以热加载的配置项立即生效
+	if want := []string{"https://b.example"}; !reflect.DeepEqual(next.Server.CorsOrigins, want) {
+		t.Errorf("server.corsOrigins = %q, want %q", next.Server.CorsOrigins, want)
+	}
+	if next.Server.LogLevel != "debug" {
+		t.Errorf("server.logLevel = %q, want debug", next.Server.LogLevel)
+	}
+	if next.Upload.MaxSize != 2048 || next.Upload.MaxFiles != 10 {
+		t.Errorf("upload limits = %d/%d, want 2048/10", next.Upload.MaxSize, next.Upload.MaxFiles)
+	}
+	if next.Reaper.Interval != 60 || next.Reaper.TusExpire != 0 {
+		t.Errorf("reaper = %+v, want interval 60 and tusExpire 0", next.Reaper)
+	}
+	if next.RateLimit.IP.Rate != 5 || next.RateLimit.IP.Burst != 50 {
+		t.Errorf("ratelimit.ip = %+v, want rate 5 burst 50", next.RateLimit.IP)
+	}
+
+	// 其余配置项需要重启服务,保持启动时的值
+	if next.Server.Port != before.Server.Port {
+		t.Errorf("server.port = %q, want %q until restart", next.Server.Port, before.Server.Port)
+	}
+	if next.Upload.TusPath != before.Upload.TusPath {
+		t.Errorf("upload.tusPath = %q, want %q until restart", next.Upload.TusPath, before.Upload.TusPath)
+	}
+	if next.Database.Path != before.Database.Path {
+		t.Errorf("database.path = %q, want %q until restart", next.Database.Path, before.Database.Path)
+	}
+	// 启动时的配置不会被修改
+	if Config.Upload.MaxSize != before.Upload.MaxSize || !reflect.DeepEqual(Config.Server.CorsOrigins, before.Server.CorsOrigins) {
+		t.Error("Reload modified the startup config")
+	}
+	if before.Upload.MaxSize != 1024 {
+		t.Errorf("previous snapshot changed: upload.maxSize = %d", before.Upload.MaxSize)
+	}
+}
+
+func TestReloadKeepsCurrentConfig(t *testing.T) {
+	dir := setupReload(t, map[string]string{"upload.yaml": "maxSize: 1024\n"})
+	before := Current()
+
+	notified := 0
+	OnReload(func(c *ConfigUtil) { notified++ })
+
+	// 只修改了需要重启的配置项时不通知
+	writeConfig(t, dir, "server.yaml", "port: \"9100\"\n")
+	Reload()
+	if Current() != before || notified != 0 {
+		t.Errorf("reload without reloadable changes replaced the snapshot (notified %d)", notified)
+	}
+
+	// 校验失败时继续使用当前配置
+	writeConfig(t, dir, "upload.yaml", "maxSize: -1\n")
+	Reload()
+	if Current() != before || notified != 0 {
+		t.Errorf("invalid config replaced the snapshot (notified %d)", notified)
+	}
+	if Current().Upload.MaxSize != 1024 {
+		t.Errorf("upload.maxSize = %d, want 1024", Current().Upload.MaxSize)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	old := defaultConfig()
+	next := defaultConfig()
+	next.Server.CorsOrigins = []string{"https://a.example"}
+	next.Upload.MaxSize = old.Upload.MaxSize + 1
+	next.Encryption.Enabled = true
+
+	changes := diffConfig(&old, &next)
+	var keys []string
+	for _, change := range changes {
+		keys = append(keys, change.key)
+	}
+	if want := []string{"server.corsOrigins", "upload.maxSize", "encryption.enabled"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("diffConfig keys = %q, want %q", keys, want)
+	}
+	if len(diffConfig(&old, &old)) != 0 {
+		t.Error("diffConfig reported changes for identical configs")
+	}
+}
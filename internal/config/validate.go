@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+)
+
+// validator 收集所有无效的配置项,一次返回全部错误
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(ok bool, key, message string) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s", key, message))
+	}
+}
+
+func (v *validator) nonNegative(value int64, key string) {
+	v.check(value >= 0, key, "不能小于0")
+}
+
+func (v *validator) oneOf(value, key string, options ...string) {
+	for _, option := range options {
+		if value == option {
+			return
+		}
+	}
+	v.check(false, key, fmt.Sprintf("必须为 %q 之一,当前为 %q", options, value))
+}
+
+// Validate 校验配置,返回所有无效的配置项
+func (c *ConfigUtil) Validate() error {
+	v := &validator{}
+	c.Server.validate(v)
+	c.Database.validate(v)
+	c.Storage.validate(v)
+
+	v.check(c.Upload.MaxSize > 0, "upload.maxSize", "必须大于0")
+	v.check(c.Upload.TusPath != "", "upload.tusPath", "不能为空")
+	v.nonNegative(int64(c.Upload.MaxFiles), "upload.maxFiles")
+
+	v.nonNegative(c.Reaper.Interval, "reaper.interval")
+	v.nonNegative(c.Reaper.GracePeriod, "reaper.gracePeriod")
+	v.nonNegative(c.Reaper.TusExpire, "reaper.tusExpire")
+
+	v.nonNegative(c.Security.DownloadUrlExpire, "security.downloadUrlExpire")
+
+	v.check(c.RateLimit.IP.Rate >= 0, "ratelimit.ip.rate", "不能小于0")
+	v.nonNegative(int64(c.RateLimit.IP.Burst), "ratelimit.ip.burst")
+	v.check(c.RateLimit.Code.Rate >= 0, "ratelimit.code.rate", "不能小于0")
+	v.nonNegative(int64(c.RateLimit.Code.Burst), "ratelimit.code.burst")
+	v.nonNegative(int64(c.RateLimit.Lockout.Threshold), "ratelimit.lockout.threshold")
+	v.nonNegative(c.RateLimit.Lockout.Window, "ratelimit.lockout.window")
+	v.nonNegative(c.RateLimit.Lockout.Duration, "ratelimit.lockout.duration")
+	v.nonNegative(c.RateLimit.Lockout.MaxDuration, "ratelimit.lockout.maxDuration")
+
+	c.Code.validate(v)
+
+	v.check(c.Preview.ThumbnailSize > 0, "preview.thumbnailSize", "必须大于0")
+	v.nonNegative(c.Preview.MaxImageSize, "preview.maxImageSize")
+	v.check(c.Preview.MaxImagePixels > 0, "preview.maxImagePixels", "必须大于0")
+	v.check(c.Preview.MaxTextSize > 0, "preview.maxTextSize", "必须大于0")
+	v.check(c.Preview.CachePath != "", "preview.cachePath", "不能为空")
+
+	c.Encryption.validate(v)
+	return errors.Join(v.errs...)
+}
+
+func (c *ServerConfig) validate(v *validator) {
+	v.oneOf(c.Mode, "server.mode", "release", "debug")
+	v.oneOf(c.LogLevel, "server.logLevel", "debug", "info", "warn", "error")
+	for i, proxy := range c.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		v.check(err == nil || net.ParseIP(proxy) != nil, fmt.Sprintf("server.trustedProxies[%d]", i), "必须为IP地址或网段,如 127.0.0.1 或 10.0.0.0/8")
+	}
+	for i, origin := range c.CorsOrigins {
+		v.check(origin != "", fmt.Sprintf("server.corsOrigins[%d]", i), "不能为空")
+	}
+	v.oneOf(c.Network, "server.network", "tcp", "unix")
+	switch c.Network {
+	case "tcp":
+		port, err := strconv.Atoi(c.Port)
+		v.check(err == nil && port > 0 && port <= 65535, "server.port", "必须为1-65535之间的端口号")
+	case "unix":
+		v.check(c.Socket != "", "server.socket", "network为unix时不能为空")
+		_, err := strconv.ParseUint(c.SocketMode, 8, 32)
+		v.check(c.SocketMode == "" || err == nil, "server.socketMode", "必须为八进制的文件权限,如0660")
+	}
+	v.nonNegative(c.ReadHeaderTimeout, "server.readHeaderTimeout")
+	v.nonNegative(c.ReadTimeout, "server.readTimeout")
+	v.nonNegative(c.WriteTimeout, "server.writeTimeout")
+	v.nonNegative(c.IdleTimeout, "server.idleTimeout")
+	v.nonNegative(c.ShutdownTimeout, "server.shutdownTimeout")
+	if c.TLS.Enabled {
+		v.check(c.TLS.CertFile != "", "server.tls.certFile", "启用TLS时不能为空")
+		v.check(c.TLS.KeyFile != "", "server.tls.keyFile", "启用TLS时不能为空")
+	}
+	v.nonNegative(c.TLS.ReloadInterval, "server.tls.reloadInterval")
+}
+
+func (c *DatabaseConfig) validate(v *validator) {
+	v.oneOf(c.Type, "database.type", "sqlite", "postgres", "mysql")
+	switch c.Type {
+	case "sqlite":
+		v.check(c.Path != "", "database.path", "使用sqlite时不能为空")
+	case "postgres", "mysql":
+		v.check(c.DSN != "", "database.dsn", "使用"+c.Type+"时不能为空")
+	}
+	v.nonNegative(int64(c.MaxOpenConns), "database.maxOpenConns")
+	v.nonNegative(int64(c.MaxIdleConns), "database.maxIdleConns")
+	v.nonNegative(c.ConnMaxLifetime, "database.connMaxLifetime")
+	v.nonNegative(c.ConnMaxIdleTime, "database.connMaxIdleTime")
+}
+
+func (c *StorageConfig) validate(v *validator) {
+	v.oneOf(c.Type, "storage.type", "local", "s3")
+	if c.Type == "s3" {
+		v.check(c.S3.Endpoint != "", "storage.s3.endpoint", "使用s3存储时不能为空")
+		v.check(c.S3.Bucket != "", "storage.s3.bucket", "使用s3存储时不能为空")
+	}
+	v.nonNegative(c.S3.PresignExpire, "storage.s3.presignExpire")
+}
+
+func (c *CodeConfig) validate(v *validator) {
+	v.oneOf(c.Type, "code.type", "numeric", "base32", "words", "custom")
+	v.check(c.Length > 0, "code.length", "必须大于0")
+	v.check(c.Retries > 0, "code.retries", "必须大于0")
+	v.check(c.Custom.MinLength > 0, "code.custom.minLength", "必须大于0")
+	v.check(c.Custom.MaxLength >= c.Custom.MinLength, "code.custom.maxLength", "不能小于minLength")
+	_, err := regexp.Compile(c.Custom.Pattern)
+	v.check(err == nil, "code.custom.pattern", "不是有效的正则表达式")
+}
+
+func (c *EncryptionConfig) validate(v *validator) {
+	v.nonNegative(int64(c.ChunkSize), "encryption.chunkSize")
+	for i, key := range c.MasterKeys {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		v.check(err == nil && len(decoded) == 32, fmt.Sprintf("encryption.masterKeys[%d]", i), "必须为base64编码的32字节密钥")
+	}
+	if c.Enabled && len(c.MasterKeys) == 0 {
+		v.check(c.KeyFile != "", "encryption.keyFile", "未配置masterKeys时不能为空")
+	}
+}
@@ -1,42 +1,28 @@
 package database
 
 import (
-	"os"
+	"time"
 
 	"github.com/WindyDante/toolpost/internal/config"
 	commonModel "github.com/WindyDante/toolpost/internal/model/common"
 	shareModel "github.com/WindyDante/toolpost/internal/model/share"
 	util "github.com/WindyDante/toolpost/internal/util/err"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
 func InitDatabase() {
-	dbType := config.Config.Database.Type
-	dbPath := config.Config.Database.Path
-
-	dir := dbPath[:len(dbPath)-len("/share.db")]
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+	db, err := Open(config.Config.Database)
+	if err != nil {
 		util.HandlePanicError(&commonModel.ServerError{
-			Msg: commonModel.CREATE_DB_PATH_PANIC,
+			Msg: commonModel.INIT_DATABASE_PANIC,
 			Err: err,
 		})
 	}
+	DB = db
 
-	if dbType == "sqlite" {
-		var err error
-		DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
-		if err != nil {
-			util.HandlePanicError(&commonModel.ServerError{
-				Msg: commonModel.INIT_DATABASE_PANIC,
-				Err: err,
-			})
-		}
-	}
-
-	if err := MigrateDB(); err != nil {
+	if err := MigrateDB(DB); err != nil {
 		util.HandlePanicError(&commonModel.ServerError{
 			Msg: commonModel.DATABASE_MIGRATE_ERROR,
 			Err: err,
@@ -44,13 +30,158 @@ func InitDatabase() {
 	}
 }
 
+// Close 关闭数据库连接
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // MigrateDB 执行数据库迁移
-func MigrateDB() error {
+func MigrateDB(db *gorm.DB) error {
 	models := []interface{}{
 		shareModel.Share{},
+		shareModel.ShareItem{},
+		shareModel.Blob{},
+		shareModel.TusUpload{},
 	}
 
-	return DB.AutoMigrate(
+	// 创建访问码唯一索引前先处理已有的重复访问码
+	if err := dedupeShareCodes(db); err != nil {
+		return err
+	}
+
+	// 修改为NOT NULL前先处理已有的NULL值
+	if err := backfillShareCounters(db); err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(
 		models...,
-	)
+	); err != nil {
+		return err
+	}
+
+	migrated, err := migrateShareExpiry(db)
+	if err != nil || !migrated {
+		return err
+	}
+	// SQLite 删除字段时会重建表,表上的索引会一起丢失,需要重新创建
+	return db.AutoMigrate(&shareModel.Share{})
+}
+
+// backfillShareCounters 将旧版本中为NULL的下载次数相关字段设为0
+// 这些字段之前允许为NULL,NULL与任何值比较都不成立,会导致旧分享被判断为下载次数已用完
+func backfillShareCounters(db *gorm.DB) error {
+	columns := []struct {
+		name  string
+		value any
+	}{
+		{"max_downloads", 0},
+		{"downloads", 0},
+		{"burn_after_read", false},
+	}
+	migrator := db.Migrator()
+	for _, column := range columns {
+		if !migrator.HasColumn(&shareModel.Share{}, column.name) {
+			continue
+		}
+		if err := db.Model(&shareModel.Share{}).
+			Where(column.name+" IS NULL").
+			UpdateColumn(column.name, column.value).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateShareExpiry 将旧版本的 expire/expire_unit 转换为 expires_at 并删除旧字段,返回是否执行了迁移
+func migrateShareExpiry(db *gorm.DB) (bool, error) {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&shareModel.Share{}, "expire") {
+		return false, nil
+	}
+
+	type legacyShare struct {
+		ID         string
+		Expire     int64
+		ExpireUnit int64
+		CreatedAt  time.Time
+	}
+	var rows []legacyShare
+	if err := db.Table("shares").
+		Select("id, expire, expire_unit, created_at").
+		Where("expire > 0").
+		Scan(&rows).Error; err != nil {
+		return false, err
+	}
+
+	return true, db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			expiresAt := row.CreatedAt.Add(legacyExpireDuration(row.Expire, row.ExpireUnit))
+			if err := tx.Model(&shareModel.Share{}).
+				Where("id = ?", row.ID).
+				UpdateColumn("expires_at", expiresAt).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Migrator().DropColumn(&shareModel.Share{}, "expire"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&shareModel.Share{}, "expire_unit")
+	})
+}
+
+// dedupeShareCodes 处理旧版本中重复的访问码
+// 按访问码查询时只会返回主键最小的分享,其余分享已经无法访问,将其标记为过期并以ID作为访问码
+func dedupeShareCodes(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&shareModel.Share{}) {
+		return nil
+	}
+
+	var codes []string
+	if err := db.Model(&shareModel.Share{}).
+		Group("code").
+		Having("COUNT(*) > 1").
+		Pluck("code", &codes).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, code := range codes {
+			var ids []string
+			if err := tx.Model(&shareModel.Share{}).
+				Where("code = ?", code).
+				Order("id").
+				Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids[1:] {
+				if err := tx.Model(&shareModel.Share{}).
+					Where("id = ?", id).
+					UpdateColumns(map[string]any{
+						"code":   id,
+						"status": shareModel.SHARE_STATUS_EXPIRED,
+					}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// legacyExpireDuration 旧版本的有效时长,单位与上传表单使用相同的 EXPIRE_UNITS
+func legacyExpireDuration(expire, expireUnit int64) time.Duration {
+	if unit, ok := shareModel.EXPIRE_UNITS[expireUnit]; ok {
+		return time.Duration(expire) * unit
+	}
+	// 其余情况与旧版本一致,按分钟处理
+	return time.Duration(expire) * time.Minute
 }
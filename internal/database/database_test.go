@@ -0,0 +1,102 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	shareModel "github.com/WindyDante/toolpost/internal/model/share"
+)
+
+func TestLegacyExpireDuration(t *testing.T) {
+	tests := []struct {
+		expire, unit int64
+		want         time.Duration
+	}{
+		{expire: 30, unit: 1, want: 30 * time.Minute},
+		{expire: 6, unit: 2, want: 6 * time.Hour},
+		{expire: 7, unit: 3, want: 7 * 24 * time.Hour},
+		{expire: 12, unit: 3600, want: 12 * time.Hour},
+		{expire: 30, unit: 86400, want: 30 * 24 * time.Hour},
+		{expire: 2, unit: 604800, want: 14 * 24 * time.Hour},
+		// 未知单位与旧版本一致按分钟处理
+		{expire: 5, unit: 42, want: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := legacyExpireDuration(tt.expire, tt.unit); got != tt.want {
+			t.Errorf("legacyExpireDuration(%d, %d) = %v, want %v", tt.expire, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateLegacyShares(t *testing.T) {
+	db, err := Open(config.DatabaseConfig{
+		Type: DATABASE_TYPE_SQLITE,
+		Path: filepath.Join(t.TempDir(), "share.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// 旧版本的表结构,过期时间保存为 expire/expire_unit
+	type legacyShare struct {
+		ID         string `gorm:"primaryKey"`
+		File       string `gorm:"unique;not null"`
+		Text       string
+		Expire     int64
+		ExpireUnit int64
+		Status     int
+		Code       string
+		CreatedAt  time.Time
+	}
+	legacy := db.Table("shares")
+	if err := legacy.AutoMigrate(&legacyShare{}); err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := legacy.Create(&legacyShare{
+		ID:         "1",
+		File:       "a.txt",
+		Expire:     2,
+		ExpireUnit: 2,
+		Code:       "abcd",
+		CreatedAt:  createdAt,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	migrator := db.Migrator()
+	for _, column := range []string{"expire", "expire_unit"} {
+		if migrator.HasColumn(&shareModel.Share{}, column) {
+			t.Errorf("legacy column %s was not dropped", column)
+		}
+	}
+	for _, index := range []string{"idx_shares_code", "idx_shares_file", "idx_shares_expires_at"} {
+		if !migrator.HasIndex(&shareModel.Share{}, index) {
+			t.Errorf("index %s missing after migration", index)
+		}
+	}
+
+	var share shareModel.Share
+	if err := db.First(&share, "id = ?", "1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := createdAt.Add(2 * time.Hour); share.ExpiresAt == nil || !share.ExpiresAt.Equal(want) {
+		t.Errorf("expiresAt = %v, want %v", share.ExpiresAt, want)
+	}
+	// 访问码唯一索引仍然生效
+	duplicate := shareModel.Share{ID: "2", Code: "abcd"}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Error("duplicate code accepted after migration")
+	}
+}
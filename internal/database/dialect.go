@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	commonModel "github.com/WindyDante/toolpost/internal/model/common"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	DATABASE_TYPE_SQLITE   = "sqlite"
+	DATABASE_TYPE_POSTGRES = "postgres"
+	DATABASE_TYPE_MYSQL    = "mysql"
+)
+
+// SQLITE_DSN_OPTIONS 并发写入时等待锁而不是直接返回 database is locked
+// 事务开始时即获取写锁,避免两个事务先读后写时互相等待导致其中一个失败
+const SQLITE_DSN_OPTIONS = "_busy_timeout=5000&_txlock=immediate&_journal_mode=WAL"
+
+const SQLITE_MEMORY = ":memory:" // sqlite内存数据库,只在进程运行期间保存数据
+
+var (
+	ErrDatabaseTypeUnsupported = errors.New(commonModel.DATABASE_TYPE_UNSUPPORTED)
+)
+
+// Open 根据配置选择数据库驱动并打开连接,设置连接池
+func Open(databaseConfig config.DatabaseConfig) (*gorm.DB, error) {
+	dialector, err := newDialector(databaseConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// 将唯一约束冲突等错误转换为gorm的错误,便于判断访问码冲突
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	setPool(sqlDB, databaseConfig)
+	return db, nil
+}
+
+func newDialector(databaseConfig config.DatabaseConfig) (gorm.Dialector, error) {
+	switch databaseConfig.Type {
+	case DATABASE_TYPE_SQLITE:
+		dsn, err := sqliteDSN(databaseConfig.Path)
+		if err != nil {
+			return nil, err
+		}
+		return sqlite.Open(dsn), nil
+	case DATABASE_TYPE_POSTGRES:
+		return postgres.Open(databaseConfig.DSN), nil
+	case DATABASE_TYPE_MYSQL:
+		dsnConfig, err := mysqlDriver.ParseDSN(databaseConfig.DSN)
+		if err != nil {
+			return nil, err
+		}
+		// 时间字段需要解析为time.Time
+		dsnConfig.ParseTime = true
+		return mysql.New(mysql.Config{DSNConfig: dsnConfig}), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrDatabaseTypeUnsupported, databaseConfig.Type)
+}
+
+// sqliteDSN 创建数据库文件所在的目录,并在路径后追加连接参数,路径中已有的参数优先
+// 路径可以是普通的文件路径,也可以是 file: 开头的URI,内存数据库不做处理
+func sqliteDSN(path string) (string, error) {
+	if isSQLiteMemory(path) {
+		return path, nil
+	}
+
+	file, query, _ := strings.Cut(path, "?")
+	dir := filepath.Dir(strings.TrimPrefix(file, "file:"))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", errors.New(commonModel.CREATE_DB_PATH_PANIC + ": " + err.Error())
+	}
+
+	options, err := url.ParseQuery(query)
+	if err != nil {
+		return "", err
+	}
+	defaults, _ := url.ParseQuery(SQLITE_DSN_OPTIONS)
+	for key, values := range defaults {
+		if !options.Has(key) {
+			options[key] = values
+		}
+	}
+	return file + "?" + options.Encode(), nil
+}
+
+// isSQLiteMemory 是否为sqlite内存数据库
+func isSQLiteMemory(path string) bool {
+	return path == SQLITE_MEMORY ||
+		strings.HasPrefix(path, "file::memory:") ||
+		strings.Contains(path, "mode=memory")
+}
+
+// setPool 设置连接池,sqlite内存数据库的每个连接都是独立的数据库,只能使用一个不会过期的连接
+func setPool(sqlDB *sql.DB, databaseConfig config.DatabaseConfig) {
+	if databaseConfig.Type == DATABASE_TYPE_SQLITE && isSQLiteMemory(databaseConfig.Path) {
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+		return
+	}
+	sqlDB.SetMaxOpenConns(databaseConfig.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(databaseConfig.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(databaseConfig.ConnMaxLifetime) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(databaseConfig.ConnMaxIdleTime) * time.Second)
+}
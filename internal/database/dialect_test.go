@@ -0,0 +1,203 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/WindyDante/toolpost/internal/database/testdb"
+	"gorm.io/gorm"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		makeDir string
+	}{
+		{
+			name:    "file path",
+			path:    filepath.Join(dir, "a", "share.db"),
+			want:    filepath.Join(dir, "a", "share.db") + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate",
+			makeDir: filepath.Join(dir, "a"),
+		},
+		{
+			name:    "options in path take precedence",
+			path:    filepath.Join(dir, "b", "share.db") + "?_busy_timeout=100",
+			want:    filepath.Join(dir, "b", "share.db") + "?_busy_timeout=100&_journal_mode=WAL&_txlock=immediate",
+			makeDir: filepath.Join(dir, "b"),
+		},
+		{
+			name:    "file uri",
+			path:    "file:" + filepath.Join(dir, "c", "share.db") + "?mode=rwc",
+			want:    "file:" + filepath.Join(dir, "c", "share.db") + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate&mode=rwc",
+			makeDir: filepath.Join(dir, "c"),
+		},
+		{name: "memory", path: SQLITE_MEMORY, want: SQLITE_MEMORY},
+		{name: "shared memory", path: "file::memory:?cache=shared", want: "file::memory:?cache=shared"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqliteDSN(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("sqliteDSN(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+			if tt.makeDir == "" {
+				return
+			}
+			if info, err := os.Stat(tt.makeDir); err != nil || !info.IsDir() {
+				t.Errorf("directory %s was not created: %v", tt.makeDir, err)
+			}
+		})
+	}
+}
+
+func TestOpenSQLiteMemory(t *testing.T) {
+	db := openTest(t, config.DatabaseConfig{
+		Type:         DATABASE_TYPE_SQLITE,
+		Path:         SQLITE_MEMORY,
+		MaxOpenConns: 10,
+	})
+	assertMaxOpenConns(t, db, 1)
+
+	// 每个连接都是独立的内存数据库,迁移后的表在之后的查询中必须仍然存在
+	if err := MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if !db.Migrator().HasTable("shares") {
+			t.Fatal("shares table disappeared between queries")
+		}
+	}
+}
+
+func TestOpenSQLiteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dir", "share.db")
+	db := openTest(t, config.DatabaseConfig{
+		Type:            DATABASE_TYPE_SQLITE,
+		Path:            path,
+		MaxOpenConns:    7,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: 60,
+	})
+	assertMaxOpenConns(t, db, 7)
+
+	if err := MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("database file was not created: %v", err)
+	}
+}
+
+func TestOpenMySQL(t *testing.T) {
+	// 连接字符串中没有parseTime,打开时需要自动开启
+	db := openTest(t, config.DatabaseConfig{
+		Type:         DATABASE_TYPE_MYSQL,
+		DSN:          testdb.MySQL(t),
+		MaxOpenConns: 4,
+	})
+	assertMaxOpenConns(t, db, 4)
+
+	if err := MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	if err := db.Exec("INSERT INTO shares (id, code, created_at, updated_at) VALUES (?, ?, ?, ?)", "id", "code", now, now).Error; err != nil {
+		t.Fatal(err)
+	}
+	var createdAt time.Time
+	if err := db.Raw("SELECT created_at FROM shares WHERE id = ?", "id").Row().Scan(&createdAt); err != nil {
+		t.Fatalf("scan datetime into time.Time: %v", err)
+	}
+	if !createdAt.Equal(now) {
+		t.Errorf("created_at = %v, want %v", createdAt, now)
+	}
+}
+
+func TestOpenPostgres(t *testing.T) {
+	server := testdb.Postgres(t)
+	db := openTest(t, config.DatabaseConfig{
+		Type:         DATABASE_TYPE_POSTGRES,
+		DSN:          server.DSN,
+		MaxOpenConns: 3,
+	})
+	assertMaxOpenConns(t, db, 3)
+
+	startups := server.Startups()
+	if len(startups) == 0 {
+		t.Fatal("no connection reached the server")
+	}
+	if startups[0]["user"] != "toolpost" || startups[0]["database"] != "toolpost" {
+		t.Errorf("startup parameters = %v, want user and database from dsn", startups[0])
+	}
+}
+
+func TestOpenInvalidConfig(t *testing.T) {
+	_, err := Open(config.DatabaseConfig{Type: "oracle"})
+	if !errors.Is(err, ErrDatabaseTypeUnsupported) {
+		t.Errorf("unsupported type: err = %v, want %v", err, ErrDatabaseTypeUnsupported)
+	}
+
+	if _, err := Open(config.DatabaseConfig{Type: DATABASE_TYPE_MYSQL, DSN: "not a dsn"}); err == nil {
+		t.Error("invalid mysql dsn: expected an error")
+	}
+}
+
+func TestSetPool(t *testing.T) {
+	db := openTest(t, config.DatabaseConfig{Type: DATABASE_TYPE_SQLITE, Path: filepath.Join(t.TempDir(), "share.db")})
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setPool(sqlDB, config.DatabaseConfig{Type: DATABASE_TYPE_SQLITE, Path: "share.db", MaxOpenConns: 5})
+	if got := sqlDB.Stats().MaxOpenConnections; got != 5 {
+		t.Errorf("MaxOpenConnections = %d, want 5", got)
+	}
+	// 内存数据库忽略连接池配置
+	setPool(sqlDB, config.DatabaseConfig{Type: DATABASE_TYPE_SQLITE, Path: SQLITE_MEMORY, MaxOpenConns: 5})
+	if got := sqlDB.Stats().MaxOpenConnections; got != 1 {
+		t.Errorf("MaxOpenConnections = %d, want 1 for in-memory sqlite", got)
+	}
+	// 0表示不限制
+	setPool(sqlDB, config.DatabaseConfig{Type: DATABASE_TYPE_MYSQL})
+	if got := sqlDB.Stats().MaxOpenConnections; got != 0 {
+		t.Errorf("MaxOpenConnections = %d, want 0", got)
+	}
+}
+
+func openTest(t *testing.T, databaseConfig config.DatabaseConfig) *gorm.DB {
+	t.Helper()
+	db, err := Open(databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func assertMaxOpenConns(t *testing.T, db *gorm.DB, want int) {
+	t.Helper()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sqlDB.Stats().MaxOpenConnections; got != want {
+		t.Errorf("MaxOpenConnections = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,41 @@
+// Package testdb 测试使用的本地数据库替身服务,不需要安装MySQL或PostgreSQL
+package testdb
+
+import (
+	"net"
+	"testing"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/sirupsen/logrus"
+)
+
+const MYSQL_DATABASE = "toolpost" // 替身服务中创建的数据库
+
+// MySQL 在本地随机端口启动内存中的MySQL兼容服务,返回连接字符串,测试结束后关闭
+// 服务与MySQL一样按顺序执行UPDATE的SET子句,可以用来验证与执行顺序相关的语句
+func MySQL(t testing.TB) string {
+	t.Helper()
+	logrus.SetLevel(logrus.WarnLevel)
+
+	provider := memory.NewDBProvider(memory.NewDatabase(MYSQL_DATABASE))
+	engine := sqle.NewDefault(provider)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := server.NewServer(server.Config{Listener: listener}, engine, sql.NewContext, memory.NewSessionBuilder(provider), nil)
+	if err != nil {
+		listener.Close()
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(func() {
+		srv.Close()
+	})
+
+	return "root@tcp(" + listener.Addr().String() + ")/" + MYSQL_DATABASE
+}
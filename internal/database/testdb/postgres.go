@@ -0,0 +1,128 @@
+package testdb
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// PostgresServer 只实现连接和ping的PostgreSQL协议替身服务,用于验证驱动选择、连接字符串和连接池
+// 其他查询返回错误
+type PostgresServer struct {
+	DSN string
+
+	listener net.Listener
+	mu       sync.Mutex
+	startups []map[string]string
+	wg       sync.WaitGroup
+}
+
+// Postgres 在本地随机端口启动PostgreSQL协议替身服务,测试结束后关闭
+func Postgres(t testing.TB) *PostgresServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	p := &PostgresServer{
+		DSN:      "host=" + host + " port=" + port + " user=toolpost password=secret dbname=toolpost sslmode=disable",
+		listener: listener,
+	}
+
+	p.wg.Add(1)
+	go p.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		p.wg.Wait()
+	})
+	return p
+}
+
+// Startups 客户端建立连接时发送的参数,如 user、database
+func (p *PostgresServer) Startups() []map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]map[string]string(nil), p.startups...)
+}
+
+func (p *PostgresServer) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			defer conn.Close()
+			p.handle(conn)
+		}()
+	}
+}
+
+func (p *PostgresServer) handle(conn net.Conn) {
+	backend := pgproto3.NewBackend(conn, conn)
+	if err := p.startup(conn, backend); err != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			if msg.String == "-- ping" || msg.String == "" {
+				backend.Send(&pgproto3.EmptyQueryResponse{})
+			} else {
+				backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "0A000", Message: "stand-in server only supports ping"})
+			}
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := backend.Flush(); err != nil {
+				return
+			}
+		case *pgproto3.Terminate:
+			return
+		default:
+			backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "0A000", Message: "stand-in server only supports simple queries"})
+			backend.Flush()
+			return
+		}
+	}
+}
+
+// startup 完成连接握手,不校验密码
+func (p *PostgresServer) startup(conn net.Conn, backend *pgproto3.Backend) error {
+	for {
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			if _, err := conn.Write([]byte("N")); err != nil {
+				return err
+			}
+		case *pgproto3.StartupMessage:
+			p.mu.Lock()
+			p.startups = append(p.startups, msg.Parameters)
+			p.mu.Unlock()
+
+			backend.Send(&pgproto3.AuthenticationOk{})
+			backend.Send(&pgproto3.ParameterStatus{Name: "server_version", Value: "16.0"})
+			backend.Send(&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"})
+			backend.Send(&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"})
+			backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			return backend.Flush()
+		default:
+			return errors.New("unexpected startup message")
+		}
+	}
+}
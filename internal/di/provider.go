@@ -4,11 +4,14 @@ import "github.com/WindyDante/toolpost/internal/handler/share"
 
 type Handlers struct {
 	ShareHandler *share.ShareHandler
+	TusHandler   *share.TusHandler
 }
 
 func NewHandlers(
-	shareHandler *share.ShareHandler) *Handlers {
+	shareHandler *share.ShareHandler,
+	tusHandler *share.TusHandler) *Handlers {
 	return &Handlers{
 		ShareHandler: shareHandler,
+		TusHandler:   tusHandler,
 	}
 }
@@ -7,6 +7,9 @@ import (
 	shareHandler "github.com/WindyDante/toolpost/internal/handler/share"
 	shareRepository "github.com/WindyDante/toolpost/internal/repository/share"
 	shareService "github.com/WindyDante/toolpost/internal/service/share"
+	codeUtil "github.com/WindyDante/toolpost/internal/util/code"
+	previewUtil "github.com/WindyDante/toolpost/internal/util/preview"
+	storageUtil "github.com/WindyDante/toolpost/internal/util/storage"
 	"github.com/google/wire"
 	"gorm.io/gorm"
 )
@@ -16,8 +19,29 @@ func BuildHandler(db *gorm.DB) (*Handlers, error) {
 	return &Handlers{}, nil
 }
 
+func BuildReaper(db *gorm.DB) (shareService.ReaperServiceInterface, error) {
+	wire.Build(ReaperSet)
+	return nil, nil
+}
+
 var ShareSet = wire.NewSet(
+	storageUtil.NewStorage,
+	codeUtil.NewGenerator,
+	previewUtil.NewCache,
 	shareRepository.NewShareRepository,
 	shareService.NewShareService, // 修正方法名
 	shareHandler.NewShareHandler, // 修正方法名
+	shareRepository.NewTusRepository,
+	shareService.NewTusService,
+	shareHandler.NewTusHandler,
+)
+
+var ReaperSet = wire.NewSet(
+	storageUtil.NewStorage,
+	codeUtil.NewGenerator,
+	previewUtil.NewCache,
+	shareRepository.NewShareRepository,
+	shareRepository.NewTusRepository,
+	shareService.NewTusService,
+	shareService.NewReaperService,
 )
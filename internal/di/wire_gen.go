@@ -10,6 +10,9 @@ import (
 	share3 "github.com/WindyDante/toolpost/internal/handler/share"
 	"github.com/WindyDante/toolpost/internal/repository/share"
 	share2 "github.com/WindyDante/toolpost/internal/service/share"
+	util2 "github.com/WindyDante/toolpost/internal/util/code"
+	util3 "github.com/WindyDante/toolpost/internal/util/preview"
+	"github.com/WindyDante/toolpost/internal/util/storage"
 	"github.com/google/wire"
 	"gorm.io/gorm"
 )
@@ -18,12 +21,55 @@ import (
 
 func BuildHandler(db *gorm.DB) (*Handlers, error) {
 	shareRepositoryInterface := share.NewShareRepository(db)
-	shareServiceInterface := share2.NewShareService(shareRepositoryInterface)
+	storage, err := util.NewStorage()
+	if err != nil {
+		return nil, err
+	}
+	generator, err := util2.NewGenerator()
+	if err != nil {
+		return nil, err
+	}
+	cache, err := util3.NewCache()
+	if err != nil {
+		return nil, err
+	}
+	shareServiceInterface := share2.NewShareService(shareRepositoryInterface, storage, generator, cache)
 	shareHandler := share3.NewShareHandler(shareServiceInterface)
-	handlers := NewHandlers(shareHandler)
+	tusRepositoryInterface := share.NewTusRepository(db)
+	tusServiceInterface, err := share2.NewTusService(tusRepositoryInterface, shareRepositoryInterface, storage, generator)
+	if err != nil {
+		return nil, err
+	}
+	tusHandler := share3.NewTusHandler(tusServiceInterface)
+	handlers := NewHandlers(shareHandler, tusHandler)
 	return handlers, nil
 }
 
+func BuildReaper(db *gorm.DB) (share2.ReaperServiceInterface, error) {
+	shareRepositoryInterface := share.NewShareRepository(db)
+	storage, err := util.NewStorage()
+	if err != nil {
+		return nil, err
+	}
+	cache, err := util3.NewCache()
+	if err != nil {
+		return nil, err
+	}
+	tusRepositoryInterface := share.NewTusRepository(db)
+	generator, err := util2.NewGenerator()
+	if err != nil {
+		return nil, err
+	}
+	tusServiceInterface, err := share2.NewTusService(tusRepositoryInterface, shareRepositoryInterface, storage, generator)
+	if err != nil {
+		return nil, err
+	}
+	reaperServiceInterface := share2.NewReaperService(shareRepositoryInterface, tusRepositoryInterface, tusServiceInterface, storage, cache)
+	return reaperServiceInterface, nil
+}
+
 // wire.go:
 
-var ShareSet = wire.NewSet(share.NewShareRepository, share2.NewShareService, share3.NewShareHandler)
+var ShareSet = wire.NewSet(util.NewStorage, util2.NewGenerator, util3.NewCache, share.NewShareRepository, share2.NewShareService, share3.NewShareHandler, share.NewTusRepository, share2.NewTusService, share3.NewTusHandler)
+
+var ReaperSet = wire.NewSet(util.NewStorage, util2.NewGenerator, util3.NewCache, share.NewShareRepository, share.NewTusRepository, share2.NewTusService, share2.NewReaperService)
@@ -20,12 +20,16 @@ func Execute(fn func(ctx *gin.Context) Response) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		res := fn(ctx)
 		if res.Err != nil {
-			ctx.JSON(http.StatusInternalServerError, common.Fail[string](
-				util.HandleError(&common.ServerError{
-					Msg: res.Msg,
-					Err: res.Err,
-				}),
-			))
+			msg := util.HandleError(&common.ServerError{
+				Msg: res.Msg,
+				Err: res.Err,
+			})
+			// 设置了错误码时返回对应的错误码,便于前端区分处理
+			if res.Code != 0 {
+				ctx.JSON(http.StatusInternalServerError, common.FailWithCode[string](msg, res.Code))
+			} else {
+				ctx.JSON(http.StatusInternalServerError, common.Fail[string](msg))
+			}
 			return
 		}
 
@@ -14,4 +14,24 @@ type ShareHandlerInterface interface {
 
 	// 根据分享码获取分享详情
 	GetShareDetailByCode() gin.HandlerFunc
+
+	// 根据分享码获取原始文本
+	GetShareText() gin.HandlerFunc
+}
+
+type TusHandlerInterface interface {
+	// 查询支持的tus协议版本和扩展
+	Options() gin.HandlerFunc
+
+	// 创建上传任务
+	CreateUpload() gin.HandlerFunc
+
+	// 查询已上传的偏移量
+	GetUploadOffset() gin.HandlerFunc
+
+	// 上传分片
+	UploadChunk() gin.HandlerFunc
+
+	// 终止上传任务
+	TerminateUpload() gin.HandlerFunc
 }
@@ -0,0 +1,55 @@
+package share
+
+import (
+	"errors"
+	"net/http"
+
+	commonModel "github.com/WindyDante/toolpost/internal/model/common"
+	"github.com/WindyDante/toolpost/internal/service/share"
+	"github.com/gin-gonic/gin"
+)
+
+// GetPreview 获取分享文件的预览,图片返回缩略图,文本返回截取的内容
+// 多文件分享通过item指定要预览的文件
+func (shareHandler *ShareHandler) GetPreview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		preview, err := shareHandler.shareService.GetPreview(ctx.Param("code"), sharePassword(ctx), ctx.Query("item"))
+		if err != nil {
+			markMiss(ctx, err)
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, share.ErrShareNotFound), errors.Is(err, share.ErrShareItemNotFound), errors.Is(err, share.ErrShareHasNoFile):
+				status = http.StatusNotFound
+			case errors.Is(err, share.ErrShareItemRequired):
+				status = http.StatusBadRequest
+			case errors.Is(err, share.ErrPasswordRequired), errors.Is(err, share.ErrPasswordIncorrect):
+				status = http.StatusUnauthorized
+			case errors.Is(err, share.ErrPreviewDisabled):
+				status = http.StatusForbidden
+			case errors.Is(err, share.ErrShareExpired), errors.Is(err, share.ErrShareExhausted):
+				status = http.StatusGone
+			case errors.Is(err, share.ErrPreviewUnsupported):
+				status = http.StatusUnsupportedMediaType
+			case errors.Is(err, share.ErrImageTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			}
+			ctx.JSON(status, commonModel.FailWithCode[string](err.Error(), errorCode(err)))
+			return
+		}
+
+		// 预览内容由文件内容决定,分享有密码或有效期,只允许浏览器私有缓存
+		ctx.Header("Cache-Control", "private, max-age=300")
+		if preview.ETag != "" {
+			ctx.Header("ETag", preview.ETag)
+			if etagListMatch(ctx.GetHeader("If-None-Match"), preview.ETag) {
+				ctx.Status(http.StatusNotModified)
+				return
+			}
+		}
+		ctx.Header("X-Content-Type-Options", "nosniff")
+		if preview.Truncated {
+			ctx.Header("X-Preview-Truncated", "true")
+		}
+		ctx.Data(http.StatusOK, preview.ContentType, preview.Data)
+	}
+}
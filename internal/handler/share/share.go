@@ -1,12 +1,19 @@
 package share
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/WindyDante/toolpost/internal/handler/res"
 	commonModel "github.com/WindyDante/toolpost/internal/model/common"
-	shareModel "github.com/WindyDante/toolpost/internal/model/share"
 	"github.com/WindyDante/toolpost/internal/service/share"
+	util "github.com/WindyDante/toolpost/internal/util/err"
+	storageUtil "github.com/WindyDante/toolpost/internal/util/storage"
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,10 +33,20 @@ func (shareHandler *ShareHandler) GetShareDetailByCode() gin.HandlerFunc {
 		code := ctx.Param("code")
 
 		// 根据分享码获取分享详情
-		detail, err := shareHandler.shareService.GetShareDetailByCode(code)
+		detail, err := shareHandler.shareService.GetShareDetailByCode(code, sharePassword(ctx))
 		if err != nil {
+			markMiss(ctx, err)
 			return res.Response{
-				Msg: err.Error(),
+				Code: errorCode(err),
+				Msg:  err.Error(),
+				Err:  err,
+			}
+		}
+
+		baseUrl := requestBaseUrl(ctx)
+		for i := range detail.Items {
+			if detail.Items[i].PreviewUrl != "" {
+				detail.Items[i].PreviewUrl = baseUrl + detail.Items[i].PreviewUrl
 			}
 		}
 
@@ -41,6 +58,55 @@ func (shareHandler *ShareHandler) GetShareDetailByCode() gin.HandlerFunc {
 	})
 }
 
+// GetShareItems 根据访问码获取分享中的文件列表
+func (shareHandler *ShareHandler) GetShareItems() gin.HandlerFunc {
+	return res.Execute(func(ctx *gin.Context) res.Response {
+		items, err := shareHandler.shareService.GetShareItems(ctx.Param("code"), sharePassword(ctx))
+		if err != nil {
+			markMiss(ctx, err)
+			return res.Response{
+				Code: errorCode(err),
+				Msg:  err.Error(),
+				Err:  err,
+			}
+		}
+		baseUrl := requestBaseUrl(ctx)
+		for i := range items {
+			items[i].DownloadUrl = baseUrl + items[i].DownloadUrl
+			if items[i].PreviewUrl != "" {
+				items[i].PreviewUrl = baseUrl + items[i].PreviewUrl
+			}
+		}
+
+		return res.Response{
+			Msg:  commonModel.SUCCESS_MESSAGE,
+			Data: items,
+		}
+	})
+}
+
+// GetShareText 根据访问码以 text/plain 返回分享的原始文本
+func (shareHandler *ShareHandler) GetShareText() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		text, err := shareHandler.shareService.GetShareTextByCode(ctx.Param("code"), sharePassword(ctx))
+		if err != nil {
+			markMiss(ctx, err)
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, share.ErrShareNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, share.ErrPasswordRequired), errors.Is(err, share.ErrPasswordIncorrect):
+				status = http.StatusUnauthorized
+			case errors.Is(err, share.ErrShareExpired), errors.Is(err, share.ErrShareExhausted):
+				status = http.StatusGone
+			}
+			ctx.String(status, err.Error())
+			return
+		}
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+	}
+}
+
 // DownloadFile 获取key和code分析来比对下载路径是否正确
 func (shareHandler *ShareHandler) DownloadFile() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
@@ -48,25 +114,220 @@ func (shareHandler *ShareHandler) DownloadFile() gin.HandlerFunc {
 		key := ctx.Query("key")
 		code := ctx.Query("code")
 		if key == "" || code == "" {
-			ctx.JSON(0, gin.H{
-				"msg": commonModel.INVALID_REQUEST_PARAMS,
-			})
+			ctx.JSON(http.StatusBadRequest, commonModel.Fail[string](commonModel.INVALID_REQUEST_PARAMS))
+			return
 		}
-		// 调用服务层方法获取下载链接
-		filePath, err := shareHandler.shareService.GetDownloadUrl(key, code)
+		// 调用服务层方法获取下载文件
+		// 多文件分享通过item指定要下载的文件,inline=true时可预览的文件在浏览器中直接打开
+		inline := ctx.Query("inline") == "true" || ctx.Query("inline") == "1"
+		file, err := shareHandler.shareService.GetDownloadFile(key, code, ctx.Query("item"), inline)
 		if err != nil {
-			ctx.JSON(0, gin.H{
-				"msg": err.Error(),
-			})
+			markMiss(ctx, err)
+			ctx.JSON(http.StatusOK, commonModel.FailWithCode[string](err.Error(), errorCode(err)))
+			return
+		}
+		// 存储支持预签名时重定向到存储下载,Range由存储处理
+		if file.Redirect != "" {
+			if err := file.Count(); err != nil {
+				ctx.JSON(http.StatusOK, commonModel.FailWithCode[string](err.Error(), errorCode(err)))
+				return
+			}
+			ctx.Redirect(http.StatusFound, file.Redirect)
+			return
 		}
-		// 设置下载响应头
+		defer file.Reader.Close()
+
+		// 阅后即焚的文件只允许完整下载一次
+		if file.BurnAfterRead {
+			ctx.Request.Header.Del("Range")
+		}
+		if file.ETag != "" {
+			ctx.Header("ETag", file.ETag)
+		}
+		if isFullDownload(ctx.Request, file.ETag, file.ModTime, file.Size) {
+			if err := file.Count(); err != nil {
+				ctx.JSON(http.StatusOK, commonModel.FailWithCode[string](err.Error(), errorCode(err)))
+				return
+			}
+		}
+
+		// 设置下载响应头,由 http.ServeContent 处理 Range、多段 Range 以及 If-None-Match、If-Modified-Since、If-Range
+		ctx.Header("Content-Type", file.MimeType)
+		ctx.Header("X-Content-Type-Options", "nosniff")
 		ctx.Header("Content-Description", "File Transfer")
-		ctx.Header("Content-Transfer-Encoding", "binary")
-		ctx.Header("Content-Disposition", "attachment; filename=\""+filePath+"\"")
-		ctx.Header("Content-Type", "application/octet-stream")
+		ctx.Header("Content-Disposition", storageUtil.ContentDisposition(file.Disposition, file.FileName))
+		http.ServeContent(ctx.Writer, ctx.Request, file.FileName, file.ModTime, file.Reader)
+	}
+}
+
+// isFullDownload 判断请求是否会从头开始传输文件内容,只有这样的请求才计入下载次数
+// HEAD请求、命中缓存的条件请求(304)、无效的Range请求(416)以及不包含第0个字节的Range请求(断点续传)不计入
+func isFullDownload(r *http.Request, etag string, modTime time.Time, size int64) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag != "" && etagListMatch(inm, etag) {
+			return false
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modTime.IsZero() {
+		if !modTime.Truncate(time.Second).After(ims) {
+			return false
+		}
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || !ifRangeMatch(r.Header.Get("If-Range"), etag, modTime) {
+		return true
+	}
+	ranges, err := parseRange(rangeHeader, size)
+	if err != nil {
+		return false
+	}
+	// 与 http.ServeContent 一致,没有有效的范围或范围总长度超过文件大小时返回完整内容
+	total := int64(0)
+	for _, ra := range ranges {
+		total += ra.length
+	}
+	if len(ranges) == 0 || total > size {
+		return true
+	}
+	// 任意一段(包括 bytes=-size 这样的后缀范围)包含第0个字节时视为一次下载,
+	// 否则客户端可以通过多段Range一次取得完整文件而不计入下载次数
+	for _, ra := range ranges {
+		if ra.start == 0 {
+			return true
+		}
+	}
+	return false
+}
 
-		// 返回文件内容
-		ctx.File(filePath)
+var errInvalidRange = errors.New(commonModel.INVALID_RANGE)
+
+// httpRange Range请求中的一段
+type httpRange struct {
+	start, length int64
+}
+
+// parseRange 按 http.ServeContent 相同的规则解析Range请求头
+// 返回错误时 http.ServeContent 响应416,不传输文件内容
+func parseRange(header string, size int64) ([]httpRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errInvalidRange
+	}
+	var ranges []httpRange
+	noOverlap := false
+	for _, ra := range strings.Split(header[len(prefix):], ",") {
+		ra = textproto.TrimString(ra)
+		if ra == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		start, end = textproto.TrimString(start), textproto.TrimString(end)
+		var r httpRange
+		if start == "" {
+			// 后缀范围 -N 表示最后N个字节
+			if end == "" || end[0] == '-' {
+				return nil, errInvalidRange
+			}
+			i, err := strconv.ParseInt(end, 10, 64)
+			if i < 0 || err != nil {
+				return nil, errInvalidRange
+			}
+			if i > size {
+				i = size
+			}
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errInvalidRange
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errInvalidRange
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errInvalidRange
+	}
+	return ranges, nil
+}
+
+// etagListMatch If-None-Match 中是否包含指定的ETag,使用弱比较
+func etagListMatch(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatch If-Range 条件成立时Range才生效,否则返回完整内容
+func ifRangeMatch(header string, etag string, modTime time.Time) bool {
+	if header == "" {
+		return true
+	}
+	if strings.HasPrefix(header, `"`) {
+		return etag != "" && header == etag
+	}
+	t, err := http.ParseTime(header)
+	return err == nil && !modTime.IsZero() && !modTime.Truncate(time.Second).After(t)
+}
+
+// DownloadArchive 将分享中的所有文件打包下载,format为zip(默认)或tar.gz
+func (shareHandler *ShareHandler) DownloadArchive() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.Query("key")
+		code := ctx.Query("code")
+		if key == "" || code == "" {
+			ctx.JSON(http.StatusBadRequest, commonModel.Fail[string](commonModel.INVALID_REQUEST_PARAMS))
+			return
+		}
+		archive, err := shareHandler.shareService.GetDownloadArchive(key, code, ctx.Query("format"))
+		if err != nil {
+			markMiss(ctx, err)
+			ctx.JSON(http.StatusOK, commonModel.FailWithCode[string](err.Error(), errorCode(err)))
+			return
+		}
+
+		// 压缩包边生成边写入响应,大小未知,使用分块传输
+		ctx.Header("Content-Type", archive.ContentType)
+		ctx.Header("Content-Description", "File Transfer")
+		ctx.Header("Content-Disposition", storageUtil.ContentDisposition(storageUtil.DISPOSITION_ATTACHMENT, archive.FileName))
+		ctx.Status(http.StatusOK)
+		if err := archive.Write(ctx.Writer); err != nil {
+			// 响应头已经发送,只能记录错误并中断
+			util.HandleError(&commonModel.ServerError{
+				Msg: commonModel.ARCHIVE_WRITE_FAILED,
+				Err: err,
+			})
+			ctx.Abort()
+		}
 	}
 }
 
@@ -76,18 +337,16 @@ func (shareHandler *ShareHandler) GetShareByCode() gin.HandlerFunc {
 		code := ctx.Param("code")
 
 		// 获取分享信息
-		url, err := shareHandler.shareService.GetShareByCode(code)
+		url, err := shareHandler.shareService.GetShareByCode(code, sharePassword(ctx))
 		if err != nil {
+			markMiss(ctx, err)
 			return res.Response{
-				Msg: err.Error(),
-				Err: err,
+				Code: errorCode(err),
+				Msg:  err.Error(),
+				Err:  err,
 			}
 		}
-		scheme := "http"
-		if ctx.Request.TLS != nil {
-			scheme = "https"
-		}
-		url = fmt.Sprintf("%s://%s%s", scheme, ctx.Request.Host, url)
+		url = requestBaseUrl(ctx) + url
 
 		return res.Response{
 			Msg:  commonModel.SUCCESS_MESSAGE,
@@ -98,9 +357,8 @@ func (shareHandler *ShareHandler) GetShareByCode() gin.HandlerFunc {
 
 func (shareHandler *ShareHandler) UploadAnyFile() gin.HandlerFunc {
 	return res.Execute(func(ctx *gin.Context) res.Response {
-		// 绑定请求体到 UploadFile 结构体
-		var uploadFile shareModel.UploadFile
-		err := ctx.ShouldBind(&uploadFile)
+		// 以流的方式读取表单,避免缓存整个请求体
+		reader, err := ctx.Request.MultipartReader()
 		if err != nil {
 			return res.Response{
 				Msg: commonModel.INVALID_REQUEST_FORM,
@@ -108,7 +366,7 @@ func (shareHandler *ShareHandler) UploadAnyFile() gin.HandlerFunc {
 			}
 		}
 		// 上传文件
-		vo, err := shareHandler.shareService.UploadAnyFile(uploadFile)
+		vo, err := shareHandler.shareService.UploadAnyFile(reader)
 		if err != nil {
 			return res.Response{
 				Msg: err.Error(),
@@ -121,3 +379,36 @@ func (shareHandler *ShareHandler) UploadAnyFile() gin.HandlerFunc {
 		}
 	})
 }
+
+// requestBaseUrl 根据请求获取服务访问地址,例如 http://localhost:6332
+func requestBaseUrl(ctx *gin.Context) string {
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, ctx.Request.Host)
+}
+
+// sharePassword 从请求头获取访问密码,不接受查询参数,避免密码出现在访问日志和浏览器历史中
+// 下载链接由签名授权,不需要密码
+func sharePassword(ctx *gin.Context) string {
+	return ctx.GetHeader("X-Share-Password")
+}
+
+// errorCode 需要密码或密码错误时返回对应的错误码,便于前端弹出密码输入框
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, share.ErrPasswordRequired):
+		return commonModel.PASSWORD_REQUIRED_CODE
+	case errors.Is(err, share.ErrPasswordIncorrect):
+		return commonModel.PASSWORD_INCORRECT_CODE
+	}
+	return commonModel.DEFAULT_FAIL_CODE
+}
+
+// markMiss 分享码不存在、密码错误或下载密钥不匹配时标记为失败访问,由限流中间件累计失败次数
+func markMiss(ctx *gin.Context, err error) {
+	if errors.Is(err, share.ErrShareNotFound) || errors.Is(err, share.ErrPasswordIncorrect) || errors.Is(err, share.ErrKeyNotMatch) {
+		ctx.Set(commonModel.CTX_SHARE_MISS, true)
+	}
+}
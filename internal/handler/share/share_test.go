@@ -0,0 +1,52 @@
+package share
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsFullDownload(t *testing.T) {
+	const size = 100
+	modTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "full", want: true},
+		{name: "head", method: "HEAD", want: false},
+		{name: "from start", headers: map[string]string{"Range": "bytes=0-9"}, want: true},
+		{name: "resume", headers: map[string]string{"Range": "bytes=50-"}, want: false},
+		{name: "suffix whole file", headers: map[string]string{"Range": "bytes=-100"}, want: true},
+		{name: "suffix longer than file", headers: map[string]string{"Range": "bytes=-1000"}, want: true},
+		{name: "suffix tail", headers: map[string]string{"Range": "bytes=-10"}, want: false},
+		{name: "multi range covering start", headers: map[string]string{"Range": "bytes=1-,0-0"}, want: true},
+		{name: "multi range without start", headers: map[string]string{"Range": "bytes=10-19,30-39"}, want: false},
+		{name: "ranges larger than file", headers: map[string]string{"Range": "bytes=1-,1-"}, want: true},
+		{name: "only empty ranges", headers: map[string]string{"Range": "bytes=,"}, want: true},
+		{name: "invalid unit", headers: map[string]string{"Range": "items=0-"}, want: false},
+		{name: "invalid spec", headers: map[string]string{"Range": "bytes=5-1"}, want: false},
+		{name: "no overlap", headers: map[string]string{"Range": "bytes=100-"}, want: false},
+		{name: "if-range mismatch", headers: map[string]string{"Range": "bytes=50-", "If-Range": `"other"`}, want: true},
+		{name: "if-none-match hit", headers: map[string]string{"If-None-Match": `"etag"`}, want: false},
+		{name: "not modified", headers: map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			r := httptest.NewRequest(method, "/share/download", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := isFullDownload(r, `"etag"`, modTime, size); got != tt.want {
+				t.Errorf("isFullDownload = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
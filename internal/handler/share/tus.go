@@ -0,0 +1,209 @@
+package share
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	commonModel "github.com/WindyDante/toolpost/internal/model/common"
+	shareModel "github.com/WindyDante/toolpost/internal/model/share"
+	"github.com/WindyDante/toolpost/internal/service/share"
+	"github.com/gin-gonic/gin"
+)
+
+type TusHandler struct {
+	tusService share.TusServiceInterface
+}
+
+func NewTusHandler(tusService share.TusServiceInterface) *TusHandler {
+	return &TusHandler{
+		tusService: tusService,
+	}
+}
+
+// Options 返回服务端支持的tus协议版本和扩展
+func (tusHandler *TusHandler) Options() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Tus-Resumable", shareModel.TUS_VERSION)
+		ctx.Header("Tus-Version", shareModel.TUS_VERSION)
+		ctx.Header("Tus-Extension", shareModel.TUS_EXTENSION)
+		ctx.Header("Tus-Max-Size", strconv.FormatInt(config.Current().Upload.MaxSize, 10))
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// CreateUpload 创建上传任务,文件信息通过Upload-Metadata传递
+func (tusHandler *TusHandler) CreateUpload() gin.HandlerFunc {
+	return tusExecute(func(ctx *gin.Context) {
+		length, err := strconv.ParseInt(ctx.GetHeader("Upload-Length"), 10, 64)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, commonModel.TUS_INVALID_LENGTH)
+			return
+		}
+
+		rawMetadata := ctx.GetHeader("Upload-Metadata")
+		upload, err := parseTusMetadata(rawMetadata)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, commonModel.INVALID_REQUEST_PARAMS)
+			return
+		}
+		upload.Length = length
+		// 保存的元数据中去掉密码,HEAD请求不回显密码
+		upload.Metadata = removeTusMetadata(rawMetadata, "password")
+
+		upload, err = tusHandler.tusService.CreateUpload(upload)
+		if err != nil {
+			writeTusError(ctx, err)
+			return
+		}
+
+		ctx.Header("Location", requestBaseUrl(ctx)+"/api/tus/"+upload.ID)
+		ctx.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		if upload.ShareCode != "" {
+			ctx.Header("Upload-Share-Code", upload.ShareCode)
+		}
+		ctx.Status(http.StatusCreated)
+	})
+}
+
+// GetUploadOffset 查询上传任务已接收的字节数
+func (tusHandler *TusHandler) GetUploadOffset() gin.HandlerFunc {
+	return tusExecute(func(ctx *gin.Context) {
+		upload, err := tusHandler.tusService.GetUpload(ctx.Param("id"))
+		if err != nil {
+			writeTusError(ctx, err)
+			return
+		}
+
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		ctx.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		if upload.Metadata != "" {
+			ctx.Header("Upload-Metadata", upload.Metadata)
+		}
+		if upload.ShareCode != "" {
+			ctx.Header("Upload-Share-Code", upload.ShareCode)
+		}
+		ctx.Status(http.StatusOK)
+	})
+}
+
+// UploadChunk 从指定偏移量追加上传分片,最后一个分片到达后生成分享
+func (tusHandler *TusHandler) UploadChunk() gin.HandlerFunc {
+	return tusExecute(func(ctx *gin.Context) {
+		if ctx.ContentType() != shareModel.TUS_CONTENT_TYPE {
+			ctx.String(http.StatusUnsupportedMediaType, commonModel.TUS_INVALID_CONTENT_TYPE)
+			return
+		}
+		offset, err := strconv.ParseInt(ctx.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			ctx.String(http.StatusBadRequest, commonModel.TUS_OFFSET_MISMATCH)
+			return
+		}
+
+		vo, err := tusHandler.tusService.WriteChunk(ctx.Param("id"), offset, ctx.Request.Body)
+		if err != nil {
+			writeTusError(ctx, err)
+			return
+		}
+
+		ctx.Header("Upload-Offset", strconv.FormatInt(vo.Offset, 10))
+		if vo.ShareCode != "" {
+			ctx.Header("Upload-Share-Code", vo.ShareCode)
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+}
+
+// TerminateUpload 终止上传任务并删除已接收的分片
+func (tusHandler *TusHandler) TerminateUpload() gin.HandlerFunc {
+	return tusExecute(func(ctx *gin.Context) {
+		if err := tusHandler.tusService.TerminateUpload(ctx.Param("id")); err != nil {
+			writeTusError(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+}
+
+// tusExecute 校验Tus-Resumable请求头并在响应中携带协议版本
+func tusExecute(fn gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Tus-Resumable", shareModel.TUS_VERSION)
+		if ctx.GetHeader("Tus-Resumable") != shareModel.TUS_VERSION {
+			ctx.Header("Tus-Version", shareModel.TUS_VERSION)
+			ctx.String(http.StatusPreconditionFailed, commonModel.TUS_VERSION_UNSUPPORTED)
+			return
+		}
+		fn(ctx)
+	}
+}
+
+// writeTusError 将服务层错误转换为对应的HTTP状态码
+func writeTusError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, share.ErrTusUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, share.ErrTusOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, share.ErrTusInvalidLength),
+		errors.Is(err, share.ErrInvalidExpire),
+		errors.Is(err, share.ErrExpireUnitUnsupported):
+		status = http.StatusBadRequest
+	case errors.Is(err, share.ErrFileMaxSizeExceeded):
+		status = http.StatusRequestEntityTooLarge
+	}
+	ctx.String(status, err.Error())
+}
+
+// removeTusMetadata 从Upload-Metadata中移除指定的键
+func removeTusMetadata(rawMetadata string, key string) string {
+	pairs := make([]string, 0)
+	for _, pair := range strings.Split(rawMetadata, ",") {
+		pair = strings.TrimSpace(pair)
+		if name, _, _ := strings.Cut(pair, " "); pair == "" || name == key {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseTusMetadata 解析Upload-Metadata,格式为逗号分隔的"key base64(value)"
+func parseTusMetadata(rawMetadata string) (shareModel.TusUpload, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(rawMetadata, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return shareModel.TusUpload{}, err
+		}
+		metadata[key] = string(value)
+	}
+
+	upload := shareModel.TusUpload{
+		FileName: metadata["filename"],
+	}
+	if upload.FileName == "" {
+		upload.FileName = metadata["name"]
+	}
+	if upload.FileName == "" {
+		upload.FileName = "file"
+	}
+
+	// 其余字段与普通上传表单一致
+	for key, value := range metadata {
+		if err := upload.Form.SetField(key, value); err != nil {
+			return shareModel.TusUpload{}, err
+		}
+	}
+	return upload, nil
+}
@@ -2,23 +2,46 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/WindyDante/toolpost/internal/config"
 	"github.com/gin-gonic/gin"
 )
 
-// Cors 跨域配置中间件
+// Cors 跨域配置中间件,允许的来源每次请求时读取,配置热加载后立即生效
 func Cors() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		method := c.Request.Method
 
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token, Authorization, Token, x-token")
-		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, DELETE, PATCH, PUT")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
+		// 指定了来源时按请求的来源返回,缓存需要区分不同的来源
+		origin := allowedOrigin(config.Current().Server.CorsOrigins, c.GetHeader("Origin"))
+		if origin != "*" {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		if origin != "" {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		c.Header("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token, Authorization, Token, x-token, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, X-Share-Password, Range, If-None-Match, If-Modified-Since, If-Range")
+		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, DELETE, PATCH, PUT, HEAD")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type, Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Share-Code, Retry-After, ETag, Last-Modified, Accept-Ranges, Content-Range, Content-Disposition, X-Preview-Truncated")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
-		if method == "OPTIONS" {
+		// 只拦截跨域预检请求,普通的OPTIONS请求(如tus协议探测)交给路由处理
+		if method == "OPTIONS" && c.GetHeader("Access-Control-Request-Method") != "" {
 			c.AbortWithStatus(http.StatusNoContent)
 		}
 	}
 }
+
+// allowedOrigin 返回响应中允许的来源,配置包含 * 时允许所有来源,来源不在配置中时返回空
+func allowedOrigin(origins []string, origin string) string {
+	for _, allowed := range origins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
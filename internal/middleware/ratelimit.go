@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	commonModel "github.com/WindyDante/toolpost/internal/model/common"
+	util "github.com/WindyDante/toolpost/internal/util/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit 通过分享码访问的接口的限流中间件,用于查询分享和校验密码
+// 按客户端IP和分享码分别限流,handler标记失败访问后累计失败次数,超过阈值时锁定客户端IP
+// 配置热加载后使用新的限额,已有的令牌桶和锁定状态保存在store中不受影响
+func RateLimit(store util.Store) gin.HandlerFunc {
+	current := reloadLimiter(store)
+
+	return func(ctx *gin.Context) {
+		limiter := current.Load()
+		ip := ctx.ClientIP()
+
+		if wait := limiter.Allow(ip, ctx.Param("code"), time.Now()); wait > 0 {
+			abortTooManyRequests(ctx, wait)
+			return
+		}
+
+		ctx.Next()
+
+		if ctx.GetBool(commonModel.CTX_SHARE_MISS) {
+			limiter.Miss(ip, time.Now())
+		}
+	}
+}
+
+// Lockout 签名下载链接的中间件,只拒绝已被锁定的客户端IP并累计失败次数
+// 下载链接已由签名授权,断点续传的Range和HEAD请求不消耗分享码的限额,避免他人通过请求耗尽限额阻止正常下载
+func Lockout(store util.Store) gin.HandlerFunc {
+	current := reloadLimiter(store)
+
+	return func(ctx *gin.Context) {
+		limiter := current.Load()
+		ip := ctx.ClientIP()
+
+		if wait := limiter.Locked(ip, time.Now()); wait > 0 {
+			abortTooManyRequests(ctx, wait)
+			return
+		}
+
+		ctx.Next()
+
+		if ctx.GetBool(commonModel.CTX_SHARE_MISS) {
+			limiter.Miss(ip, time.Now())
+		}
+	}
+}
+
+// reloadLimiter 根据当前配置创建Limiter,配置热加载后替换为新的Limiter
+func reloadLimiter(store util.Store) *atomic.Pointer[util.Limiter] {
+	var current atomic.Pointer[util.Limiter]
+	current.Store(newLimiter(store, config.Current().RateLimit))
+	config.OnReload(func(c *config.ConfigUtil) {
+		current.Store(newLimiter(store, c.RateLimit))
+	})
+	return &current
+}
+
+func abortTooManyRequests(ctx *gin.Context, wait time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(util.RetryAfterSeconds(wait)))
+	ctx.AbortWithStatusJSON(http.StatusTooManyRequests, commonModel.Fail[string](commonModel.TOO_MANY_REQUESTS))
+}
+
+func newLimiter(store util.Store, cfg config.RateLimitConfig) *util.Limiter {
+	return util.NewLimiter(
+		store,
+		util.Limit{Rate: cfg.IP.Rate, Burst: cfg.IP.Burst},
+		util.Limit{Rate: cfg.Code.Rate, Burst: cfg.Code.Burst},
+		util.LockoutPolicy{
+			Threshold:   cfg.Lockout.Threshold,
+			Window:      time.Duration(cfg.Lockout.Window) * time.Second,
+			Duration:    time.Duration(cfg.Lockout.Duration) * time.Second,
+			MaxDuration: time.Duration(cfg.Lockout.MaxDuration) * time.Second,
+		},
+	)
+}
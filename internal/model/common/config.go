@@ -3,4 +3,10 @@ package model
 const (
 	CONFIG_FILE_PREFIX = "config/"
 	CONFIG_TYPE_YAML   = "yaml"
+	CONFIG_ENV_PREFIX  = "TOOLPOST"        // 环境变量覆盖配置项的前缀,如 TOOLPOST_SERVER_PORT
+	CONFIG_DIR_ENV     = "TOOLPOST_CONFIG" // 指定配置文件目录的环境变量
+)
+
+const (
+	CTX_SHARE_MISS = "shareMiss" // 上下文标记,本次请求是一次失败的分享访问
 )
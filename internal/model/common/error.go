@@ -7,15 +7,55 @@ type ServerError struct {
 
 // 失败的常量
 const (
-	INVALID_REQUEST_PARAMS = "无效的请求参数"
-	INVALID_REQUEST_FORM   = "无效的表单"
-	INVALID_SHARE_CODE     = "无效的分享码"
-	FILE_UPLOAD            = "文件上传失败"
-	FILE_MAX_SIZE_EXCEEDED = "文件大小超过限制(500MB)"
-	NO_FILE_UPLOAD         = "没有上传文件"
-	SHARE_NOT_FOUND        = "分享不存在"
-	FILE_DIRECTORY_CREATE  = "初始化文件目录失败"
-	SHARE_EXPIRED          = "分享已过期"
-	KEY_NOT_MATCH          = "密钥不匹配"
-	FILE_ALREADY_EXISTS    = "文件已存在"
+	INVALID_REQUEST_PARAMS     = "无效的请求参数"
+	INVALID_REQUEST_FORM       = "无效的表单"
+	INVALID_SHARE_CODE         = "无效的分享码"
+	FILE_UPLOAD                = "文件上传失败"
+	FILE_MAX_SIZE_EXCEEDED     = "文件大小超过限制"
+	NO_FILE_UPLOAD             = "没有上传文件或文本"
+	SHARE_NOT_FOUND            = "分享不存在"
+	FILE_DIRECTORY_CREATE      = "初始化文件目录失败"
+	SHARE_EXPIRED              = "分享已过期"
+	SHARE_HAS_NO_FILE          = "分享不包含文件"
+	SHARE_ITEM_NOT_FOUND       = "分享中不存在该文件"
+	SHARE_ITEM_REQUIRED        = "请指定要下载的文件"
+	TOO_MANY_FILES             = "上传的文件数量超过限制"
+	ARCHIVE_FORMAT_UNSUPPORTED = "不支持的压缩格式"
+	ARCHIVE_WRITE_FAILED       = "生成压缩包失败"
+	PREVIEW_UNSUPPORTED        = "该文件不支持预览"
+	PREVIEW_DISABLED           = "阅后即焚或限制下载次数的分享不支持预览"
+	PREVIEW_IMAGE_TOO_LARGE    = "图片过大,无法生成预览"
+	SHARE_EXHAUSTED            = "分享下载次数已用完"
+	INVALID_EXPIRE             = "无效的过期时间"
+	EXPIRE_UNIT_UNSUPPORTED    = "不支持的过期单位"
+	PASSWORD_REQUIRED          = "该分享需要密码"
+	PASSWORD_INCORRECT         = "分享密码错误"
+	PASSWORD_TOO_LONG          = "密码长度不能超过72字节"
+	KEY_NOT_MATCH              = "密钥不匹配"
+	INVALID_CODE_CONFIG        = "无效的访问码配置"
+	INVALID_CUSTOM_CODE        = "无效的自定义访问码"
+	CODE_ALREADY_EXISTS        = "访问码已存在"
+	CODE_GENERATE_FAILED       = "生成访问码失败,请重试"
+	DOWNLOAD_LINK_EXPIRED      = "下载链接已过期"
+	INVALID_RANGE              = "无效的Range请求"
+	NO_SIGNING_SECRET          = "未配置签名密钥"
+	INVALID_SIGNATURE          = "签名无效"
+	SIGNATURE_EXPIRED          = "签名已过期"
+	TOO_MANY_REQUESTS          = "请求过于频繁,请稍后再试"
+	FILE_ALREADY_EXISTS        = "文件已存在"
+	FILE_NOT_FOUND             = "文件不存在"
+	STORAGE_TYPE_UNSUPPORTED   = "不支持的存储类型"
+	DATABASE_TYPE_UNSUPPORTED  = "不支持的数据库类型"
+	INVALID_MASTER_KEY         = "无效的加密主密钥,需要base64编码的32字节密钥"
+	MASTER_KEY_NOT_FOUND       = "找不到文件加密使用的主密钥"
+	FILE_DECRYPT_FAILED        = "文件解密失败"
+	INVALID_SEEK_OFFSET        = "无效的偏移量"
+	NETWORK_UNSUPPORTED        = "不支持的监听方式"
+	INVALID_SOCKET_MODE        = "无效的socket文件权限"
+	TLS_CERT_REQUIRED          = "启用TLS时需要配置证书和私钥文件"
+	TUS_VERSION_UNSUPPORTED    = "不支持的tus协议版本"
+	TUS_UPLOAD_NOT_FOUND       = "上传任务不存在"
+	TUS_OFFSET_MISMATCH        = "上传偏移量不匹配"
+	TUS_INVALID_CONTENT_TYPE   = "无效的分片内容类型"
+	TUS_INVALID_LENGTH         = "无效的文件长度"
 )
@@ -3,8 +3,13 @@ package model
 const (
 	INIT_LOGGER_PANIC      = "Logger初始化失败"
 	READ_CONFIG_PANIC      = "读取配置文件失败"
+	INVALID_CONFIG_PANIC   = "配置校验失败"
 	INIT_DATABASE_PANIC    = "数据库初始化失败"
 	CREATE_DB_PATH_PANIC   = "创建数据库路径失败"
 	INIT_HANDLERS_PANIC    = "Handlers 初始化失败"
 	DATABASE_MIGRATE_ERROR = "数据库迁移失败"
+	INIT_REAPER_PANIC      = "过期清理任务初始化失败"
+	INIT_STORAGE_PANIC     = "存储初始化失败"
+	ROTATE_KEY_PANIC       = "轮换加密主密钥失败"
+	INIT_LISTENER_PANIC    = "监听地址失败"
 )
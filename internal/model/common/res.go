@@ -7,8 +7,10 @@ type Result[T any] struct {
 }
 
 const (
-	DEFAULT_SUCCESS_CODE = 1
-	DEFAULT_FAIL_CODE    = 0
+	DEFAULT_SUCCESS_CODE    = 1
+	DEFAULT_FAIL_CODE       = 0
+	PASSWORD_REQUIRED_CODE  = 2 // 分享需要密码
+	PASSWORD_INCORRECT_CODE = 3 // 分享密码错误
 )
 
 func OK[T any](data T, messages ...string) Result[T] {
@@ -32,6 +34,15 @@ func Fail[T any](message string) Result[T] {
 	}
 }
 
+func FailWithCode[T any](message string, code int) Result[T] {
+	var zero T
+	return Result[T]{
+		Code:    code,
+		Message: message,
+		Data:    zero,
+	}
+}
+
 func OKWithCode[T any](data T, code int, messages ...string) Result[T] {
 	// 如果没有传入自定义消息，则使用默认消息
 	message := SUCCESS_MESSAGE
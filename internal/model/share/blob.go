@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Blob 按内容去重后的文件,相同内容只在存储中保存一份,由引用计数决定何时删除
+type Blob struct {
+	Hash      string    `json:"hash" gorm:"primaryKey"` // 文件内容的SHA-256
+	File      string    `json:"-"`                      // 文件在存储中的key
+	RefCount  int64     `json:"refCount"`               // 引用该文件的分享及多文件分享中的文件数量
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
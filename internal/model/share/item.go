@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// ShareItem 多文件分享中的单个文件,一个访问码可以对应多个文件
+type ShareItem struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	ShareID   string    `json:"shareId" gorm:"index"` // 所属分享的ID
+	File      string    `json:"-"`                    // 文件在存储中的key
+	FileName  string    `json:"fileName"`             // 原文件名
+	Size      int64     `json:"size"`                 // 文件大小
+	MimeType  string    `json:"mimeType"`             // 文件的MIME类型
+	Hash      string    `json:"-"`                    // 文件内容的SHA-256
+	Sort      int       `json:"sort"`                 // 上传时的顺序
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ShareItemVo struct {
+	ID          string `json:"id"`                    // 文件ID,单文件分享为空
+	FileName    string `json:"fileName"`              // 原文件名
+	Size        int64  `json:"size"`                  // 文件大小
+	MimeType    string `json:"mimeType"`              // 文件的MIME类型
+	DownloadUrl string `json:"downloadUrl,omitempty"` // 下载链接,仅在文件列表中返回
+	PreviewUrl  string `json:"previewUrl,omitempty"`  // 预览链接,不支持预览时为空
+}
+
+// Preview 文件预览,图片为缩略图,文本为截取的内容
+type Preview struct {
+	ContentType string
+	Data        []byte
+	ETag        string // 由文件内容哈希生成,旧数据可能为空
+	Truncated   bool   // 文本内容是否被截断
+}
@@ -1,35 +1,147 @@
 package model
 
 import (
-	"mime/multipart"
+	"io"
+	"strconv"
 	"time"
 )
 
+const (
+	SHARE_TYPE_FILE  = "file"  // 文件分享,可附带文本
+	SHARE_TYPE_FILES = "files" // 多文件分享,可附带文本
+	SHARE_TYPE_TEXT  = "text"  // 纯文本分享
+)
+
+// 分享状态
+const (
+	SHARE_STATUS_UNUSED  = 0 // 未使用
+	SHARE_STATUS_USED    = 1 // 已使用
+	SHARE_STATUS_EXPIRED = 2 // 已过期或下载次数已用完
+)
+
 type Share struct {
-	ID         string    `json:"id" gorm:"primaryKey"`
-	File       string    `json:"url" gorm:"unique;not null"` // URL是一个文件路径
-	Text       string    `json:"text"`                       // 文本内容
-	Expire     int64     `json:"expire"`
-	ExpireUnit int64     `json:"expire_unit"` // 过期单位，秒、分钟、小时等
-	Status     int       `json:"status"`      // 状态，0表示未使用，1表示已使用，2表示已过期
-	Code       string    `json:"code"`        // 访问码
-	CreatedAt  time.Time `json:"createdAt"`   // 创建时间
+	ID        string     `json:"id" gorm:"primaryKey"`
+	File      string     `json:"url" gorm:"index"`                 // 文件在存储中的key,纯文本分享为空
+	Text      string     `json:"text"`                             // 文本内容
+	ExpiresAt *time.Time `json:"expiresAt" gorm:"index"`           // 过期时间,为空表示永不过期
+	Status    int        `json:"status"`                           // 状态，0表示未使用，1表示已使用，2表示已过期或下载次数已用完
+	Code      string     `gorm:"uniqueIndex;size:191" json:"code"` // 访问码
+	CreatedAt time.Time  `json:"createdAt"`                        // 创建时间
+	UpdatedAt time.Time  `json:"updatedAt"`                        // 更新时间,下载次数用完时即为用完的时间
+
+	MaxDownloads  int64 `json:"maxDownloads" gorm:"not null;default:0"`      // 最大下载次数,0表示不限制
+	Downloads     int64 `json:"downloads" gorm:"not null;default:0"`         // 已下载次数
+	BurnAfterRead bool  `json:"burnAfterRead" gorm:"not null;default:false"` // 阅后即焚,下载一次后删除文件
+
+	PasswordHash string `json:"-"` // 访问密码的bcrypt哈希,为空表示不需要密码
+	Hash         string `json:"-"` // 文件内容的SHA-256,纯文本分享和旧数据为空
+	FileName     string `json:"-"` // 上传时的原文件名,旧数据为空
+	MimeType     string `json:"-"` // 上传时根据内容判断的MIME类型,旧数据为空
+
+	Items []ShareItem `json:"-" gorm:"-"` // 多文件分享的文件,只在保存时使用
 }
 
+// Exhausted 下载次数是否已用完
+func (share *Share) Exhausted() bool {
+	return share.Status == SHARE_STATUS_EXPIRED ||
+		(share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads)
+}
+
+// 旧版 expireUnit 支持的单位,上传表单和旧数据迁移共用
+// 旧版后端用 1/2/3 表示分钟/小时/天,旧版前端传入单位对应的秒数,如3600表示小时
+var EXPIRE_UNITS = map[int64]time.Duration{
+	1:      time.Minute,
+	2:      time.Hour,
+	3:      24 * time.Hour,
+	60:     time.Minute,
+	3600:   time.Hour,
+	86400:  24 * time.Hour,
+	604800: 7 * 24 * time.Hour,
+}
+
+// UploadFile 上传表单中除文件以外的字段,文件内容以流的形式直接写入存储
 type UploadFile struct {
-	File       *multipart.FileHeader `form:"file" `       // 非必须,文件
-	ExpireTime int64                 `form:"expireTime" ` // 数量集
-	ExpireUnit int64                 `form:"expireUnit"`  // 过期单位，秒、分钟、小时等,无时间表示长期有效
-	Text       string                `form:"text"`        // 文本内容
-	Code       string                `form:"code"`        // 访问码,存在访问码时，为自定义访问码
+	Expire        string `form:"expire"`            // 有效时长,ISO-8601(如P7D)或Go时长(如24h),为空表示长期有效
+	ExpireTime    int64  `form:"expireTime" `       // 旧版有效时长的数量,与expireUnit一起使用
+	ExpireUnit    int64  `form:"expireUnit"`        // 旧版过期单位,取值见 EXPIRE_UNITS
+	Text          string `form:"text"`              // 文本内容
+	Code          string `form:"code"`              // 访问码,存在访问码时，为自定义访问码
+	MaxDownloads  int64  `form:"maxDownloads"`      // 最大下载次数,0表示不限制
+	BurnAfterRead bool   `form:"burnAfterRead"`     // 阅后即焚,等同于最大下载次数为1并在下载后删除文件
+	Password      string `form:"password" gorm:"-"` // 访问密码,非必须,在访问码之外额外校验,不保存明文
+}
+
+// SetField 根据表单字段名设置对应的值,未知字段忽略
+func (form *UploadFile) SetField(name, value string) error {
+	var err error
+	switch name {
+	case "expire":
+		form.Expire = value
+	case "expireTime":
+		form.ExpireTime, err = strconv.ParseInt(value, 10, 64)
+	case "expireUnit":
+		form.ExpireUnit, err = strconv.ParseInt(value, 10, 64)
+	case "text":
+		form.Text = value
+	case "code":
+		form.Code = value
+	case "maxDownloads":
+		form.MaxDownloads, err = strconv.ParseInt(value, 10, 64)
+	case "burnAfterRead":
+		form.BurnAfterRead, err = strconv.ParseBool(value)
+	case "password":
+		form.Password = value
+	}
+	return err
+}
+
+// NewShare 根据上传表单创建分享信息,访问码在保存时生成
+func (form *UploadFile) NewShare(id, file string, expiresAt *time.Time) Share {
+	maxDownloads := form.MaxDownloads
+	if form.BurnAfterRead {
+		maxDownloads = 1
+	}
+	return Share{
+		ID:            id,
+		File:          file,
+		ExpiresAt:     expiresAt,
+		Text:          form.Text,
+		MaxDownloads:  maxDownloads,
+		BurnAfterRead: form.BurnAfterRead,
+	}
 }
 
 type ShareDetailVo struct {
-	Text     string `json:"text"`     // 文本内容
-	FileName string `json:"fileName"` // 文件名
+	Type      string        `json:"type"`      // 分享类型,file、files或text
+	Text      string        `json:"text"`      // 文本内容
+	FileName  string        `json:"fileName"`  // 文件名,纯文本和多文件分享为空
+	Items     []ShareItemVo `json:"items"`     // 分享中的文件及大小、类型
+	ExpiresAt *time.Time    `json:"expiresAt"` // 过期时间,为空表示永不过期
 }
 
 type ShareVo struct {
-	FileUrl string `json:"fileUrl"` // 文件URL
-	Code    string `json:"code"`    // 访问码
+	FileUrl   string     `json:"fileUrl"`   // 文件URL,纯文本分享为空
+	Code      string     `json:"code"`      // 访问码
+	ExpiresAt *time.Time `json:"expiresAt"` // 过期时间,为空表示永不过期
+}
+
+// DownloadFile 待下载的文件
+type DownloadFile struct {
+	FileName      string            // 原文件名
+	MimeType      string            // 文件的MIME类型
+	Disposition   string            // attachment 或可预览文件的 inline
+	Size          int64             // 文件大小
+	ModTime       time.Time         // 文件修改时间,用于 Last-Modified
+	ETag          string            // 由文件内容哈希生成的ETag,旧数据可能为空
+	Reader        io.ReadSeekCloser // 文件内容,支持随机读取,使用后需要关闭
+	Redirect      string            // 存储支持预签名时的下载链接,不为空时直接重定向
+	BurnAfterRead bool              // 阅后即焚的文件只允许完整下载
+	Count         func() error      // 计入一次下载,下载次数已用完时返回错误
+}
+
+// DownloadArchive 待下载的压缩包,内容在写入响应时才生成
+type DownloadArchive struct {
+	FileName    string                  // 压缩包文件名
+	ContentType string                  // 压缩包的MIME类型
+	Write       func(w io.Writer) error // 将分享中的所有文件写入压缩包
 }
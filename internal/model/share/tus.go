@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+const (
+	TUS_VERSION      = "1.0.0"
+	TUS_EXTENSION    = "creation,termination"
+	TUS_CONTENT_TYPE = "application/offset+octet-stream"
+)
+
+// TusUpload 断点续传(tus协议)的上传任务
+type TusUpload struct {
+	ID           string     `json:"id" gorm:"primaryKey"`
+	Length       int64      `json:"length"`                             // 文件总大小
+	Offset       int64      `json:"offset" gorm:"column:upload_offset"` // 已接收的字节数
+	Metadata     string     `json:"metadata"`                           // 原始的Upload-Metadata,HEAD请求时原样返回
+	FileName     string     `json:"fileName"`                           // 原文件名
+	Form         UploadFile `json:"form" gorm:"embedded"`               // 分享设置,由Upload-Metadata传入
+	PasswordHash string     `json:"-"`                                  // 访问密码的bcrypt哈希,创建时计算,不保存明文
+	ShareCode    string     `json:"shareCode"`                          // 上传完成后分享的访问码
+	CreatedAt    time.Time  `json:"createdAt"`                          // 创建时间
+	UpdatedAt    time.Time  `json:"updatedAt"`                          // 最后一次接收分片的时间,用于清理长时间未继续的任务
+}
+
+// TusPatchVo 分片上传的结果
+type TusPatchVo struct {
+	Offset    int64  // 当前已接收的字节数
+	ShareCode string // 上传完成后分享的访问码,未完成时为空
+}
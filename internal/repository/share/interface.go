@@ -1,10 +1,40 @@
 package share
 
-import model "github.com/WindyDante/toolpost/internal/model/share"
+import (
+	"time"
+
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	"gorm.io/gorm"
+)
+
+// ErrDuplicatedKey 保存时主键或访问码与已有记录冲突
+var ErrDuplicatedKey = gorm.ErrDuplicatedKey
 
 type ShareRepositoryInterface interface {
 	SaveShare(share *model.Share) error
 	GetShareByCode(code string) (*model.Share, error)
+	// 访问码是否已被使用,包括已过期的分享
+	CodeExists(code string) (bool, error)
 	UpdateByStatus(id string) error
-	GetShareByMD5(md5Val string) (*model.Share, error)
+	// 下载次数加一,下载次数已用完时返回false
+	IncrementDownloads(id string) (bool, error)
+	// 获取过期或下载次数用完的时间早于before且还未清理的分享,按ID排序,从afterID之后最多返回limit个
+	GetReapCandidates(before time.Time, afterID string, limit int) ([]model.Share, error)
+	// 标记分享已被清理并释放文件引用,返回没有分享再引用、需要从存储中删除的文件
+	ReapShare(id string) ([]model.Blob, error)
+	// 获取所有仍被分享引用的文件key
+	GetFileKeys() ([]string, error)
+	// 获取多文件分享的文件,按上传顺序排列
+	GetShareItems(shareID string) ([]model.ShareItem, error)
+	GetShareItem(shareID string, itemID string) (*model.ShareItem, error)
+}
+
+type TusRepositoryInterface interface {
+	SaveUpload(upload *model.TusUpload) error
+	GetUploadByID(id string) (*model.TusUpload, error)
+	UpdateOffset(id string, offset int64) error
+	UpdateShareCode(id string, shareCode string) error
+	// 获取最后一次上传早于before的任务,包括已完成的任务,按ID排序,从afterID之后最多返回limit个
+	GetStaleUploads(before time.Time, afterID string, limit int) ([]model.TusUpload, error)
+	DeleteUpload(id string) error
 }
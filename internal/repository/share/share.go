@@ -1,8 +1,11 @@
 package share
 
 import (
+	"time"
+
 	model "github.com/WindyDante/toolpost/internal/model/share"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ShareRepository struct {
@@ -15,23 +18,37 @@ func NewShareRepository(db *gorm.DB) ShareRepositoryInterface {
 	}
 }
 
-func (shareRepository *ShareRepository) GetShareByMD5(md5Val string) (*model.Share, error) {
-	// 这里的md5是作为id来保存的
-	var share model.Share
-	if err := shareRepository.db.Where("id = ?", md5Val).First(&share).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil // 没有找到记录
-		}
-		return nil, err // 其他错误
-	}
-	return &share, nil // 返回找到的分享信息
+func (shareRepository *ShareRepository) UpdateByStatus(id string) error {
+	// 只更新未使用的分享,避免覆盖已过期的状态
+	return shareRepository.db.Model(&model.Share{}).
+		Where("id = ? AND status = ?", id, model.SHARE_STATUS_UNUSED).
+		Update("status", model.SHARE_STATUS_USED).Error
+}
 
+func (shareRepository *ShareRepository) IncrementDownloads(id string) (bool, error) {
+	// 在同一条UPDATE语句中判断并增加下载次数,保证并发下载时不会超过上限,达到上限时将状态置为已过期
+	// MySQL按顺序执行SET子句,后面的子句读取的是已更新的值,因此status必须在downloads之前赋值
+	// gorm会将Updates的字段按名称排序,这里直接使用SQL保证顺序
+	result := shareRepository.db.Exec(
+		"UPDATE shares SET "+
+			"status = CASE WHEN max_downloads > 0 AND downloads + 1 >= max_downloads THEN ? ELSE ? END, "+
+			"downloads = downloads + 1, updated_at = ? "+
+			"WHERE id = ? AND status <> ? AND (max_downloads = 0 OR downloads < max_downloads)",
+		model.SHARE_STATUS_EXPIRED, model.SHARE_STATUS_USED, time.Now(),
+		id, model.SHARE_STATUS_EXPIRED,
+	)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
 }
 
-func (shareRepository *ShareRepository) UpdateByStatus(id string) error {
-	return shareRepository.db.Model(&model.Share{}).
-		Where("id = ?", id).
-		Update("status", 1).Error
+func (shareRepository *ShareRepository) CodeExists(code string) (bool, error) {
+	var count int64
+	if err := shareRepository.db.Model(&model.Share{}).Where("code = ?", code).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
 func (shareRepository *ShareRepository) GetShareByCode(code string) (*model.Share, error) {
@@ -46,8 +63,179 @@ func (shareRepository *ShareRepository) GetShareByCode(code string) (*model.Shar
 }
 
 func (shareRepository *ShareRepository) SaveShare(share *model.Share) error {
-	if err := shareRepository.db.Create(share).Error; err != nil {
-		return err
+	// 多文件分享的文件与分享在同一个事务中保存,同时增加文件内容的引用计数
+	// 内容已存在时文件key替换为已有文件的key,调用方需要删除刚写入的文件
+	return shareRepository.db.Transaction(func(tx *gorm.DB) error {
+		if share.File != "" && share.Hash != "" {
+			file, err := acquireBlob(tx, share.Hash, share.File)
+			if err != nil {
+				return err
+			}
+			share.File = file
+		}
+		if err := tx.Create(share).Error; err != nil {
+			return err
+		}
+		if len(share.Items) == 0 {
+			return nil
+		}
+		for i := range share.Items {
+			share.Items[i].ShareID = share.ID
+			if share.Items[i].Hash == "" {
+				continue
+			}
+			file, err := acquireBlob(tx, share.Items[i].Hash, share.Items[i].File)
+			if err != nil {
+				return err
+			}
+			share.Items[i].File = file
+		}
+		return tx.Create(&share.Items).Error
+	})
+}
+
+// acquireBlob 增加内容对应文件的引用计数,返回应使用的文件key
+// 内容第一次出现时以file作为该内容的文件
+// 使用upsert在一条语句中插入或增加引用计数,并发上传相同的内容时不会因主键冲突失败
+func acquireBlob(tx *gorm.DB, hash, file string) (string, error) {
+	blob := model.Blob{Hash: hash, File: file, RefCount: 1}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"ref_count":  gorm.Expr("blobs.ref_count + 1"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&blob).Error; err != nil {
+		return "", err
+	}
+	// 内容已存在时以先保存的文件为准
+	if err := tx.Where("hash = ?", hash).First(&blob).Error; err != nil {
+		return "", err
+	}
+	return blob.File, nil
+}
+
+// releaseBlob 减少文件的引用计数,没有引用时删除记录并返回true
+// 旧版本保存的文件没有引用记录,只属于一个分享,直接返回true
+func releaseBlob(tx *gorm.DB, hash, file string) (bool, error) {
+	if hash == "" {
+		return true, nil
+	}
+	result := tx.Model(&model.Blob{}).
+		Where("hash = ? AND file = ?", hash, file).
+		Update("ref_count", gorm.Expr("ref_count - 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return true, nil
+	}
+	result = tx.Where("hash = ? AND ref_count <= 0", hash).Delete(&model.Blob{})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (shareRepository *ShareRepository) GetShareItems(shareID string) ([]model.ShareItem, error) {
+	var items []model.ShareItem
+	if err := shareRepository.db.Where("share_id = ?", shareID).Order("sort").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (shareRepository *ShareRepository) GetShareItem(shareID string, itemID string) (*model.ShareItem, error) {
+	var item model.ShareItem
+	if err := shareRepository.db.Where("share_id = ? AND id = ?", shareID, itemID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (shareRepository *ShareRepository) GetReapCandidates(before time.Time, afterID string, limit int) ([]model.Share, error) {
+	// 过期时间或下载次数用完的时间早于before,并且还未被清理(状态未标记或仍有文件)的分享
+	db := shareRepository.db
+	var shares []model.Share
+	if err := db.
+		Where("expires_at < ? OR ((status = ? OR (max_downloads > 0 AND downloads >= max_downloads)) AND updated_at < ?)",
+			before, model.SHARE_STATUS_EXPIRED, before).
+		Where("status <> ? OR file <> '' OR id IN (?)", model.SHARE_STATUS_EXPIRED,
+			db.Model(&model.ShareItem{}).Select("share_id")).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (shareRepository *ShareRepository) ReapShare(id string) ([]model.Blob, error) {
+	// 清空文件key并标记为已过期,释放分享及其中每个文件的引用
+	var released []model.Blob
+	err := shareRepository.db.Transaction(func(tx *gorm.DB) error {
+		released = nil
+		var share model.Share
+		if err := tx.Where("id = ?", id).First(&share).Error; err != nil {
+			return err
+		}
+		var items []model.ShareItem
+		if err := tx.Where("share_id = ?", id).Find(&items).Error; err != nil {
+			return err
+		}
+
+		release := func(hash, file string) error {
+			last, err := releaseBlob(tx, hash, file)
+			if last {
+				released = append(released, model.Blob{Hash: hash, File: file})
+			}
+			return err
+		}
+
+		// 通过带条件的更新和删除认领引用,清理任务与阅后即焚并发清理同一个分享时每个引用只释放一次
+		if share.File != "" {
+			result := tx.Model(&model.Share{}).
+				Where("id = ? AND file = ?", id, share.File).
+				Update("file", "")
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				if err := release(share.Hash, share.File); err != nil {
+					return err
+				}
+			}
+		}
+		for _, item := range items {
+			result := tx.Where("id = ?", item.ID).Delete(&model.ShareItem{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				if err := release(item.Hash, item.File); err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Model(&model.Share{}).
+			Where("id = ?", id).
+			Update("status", model.SHARE_STATUS_EXPIRED).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+func (shareRepository *ShareRepository) GetFileKeys() ([]string, error) {
+	// 包括旧版本没有引用记录的文件
+	var keys []string
+	if err := shareRepository.db.Raw(
+		"SELECT file FROM shares WHERE file <> '' UNION SELECT file FROM share_items UNION SELECT file FROM blobs",
+	).Scan(&keys).Error; err != nil {
+		return nil, err
 	}
-	return nil
+	return keys, nil
 }
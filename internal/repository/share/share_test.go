@@ -0,0 +1,158 @@
+package share
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/WindyDante/toolpost/internal/database"
+	"github.com/WindyDante/toolpost/internal/database/testdb"
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	"gorm.io/gorm"
+)
+
+// testDatabases 需要在所有数据库上表现一致的测试使用的数据库
+func testDatabases(t *testing.T) map[string]func(t *testing.T) *gorm.DB {
+	return map[string]func(t *testing.T) *gorm.DB{
+		"sqlite": func(t *testing.T) *gorm.DB {
+			return openTestDB(t, config.DatabaseConfig{Type: database.DATABASE_TYPE_SQLITE, Path: database.SQLITE_MEMORY})
+		},
+		"mysql": func(t *testing.T) *gorm.DB {
+			return openTestDB(t, config.DatabaseConfig{Type: database.DATABASE_TYPE_MYSQL, DSN: testdb.MySQL(t)})
+		},
+	}
+}
+
+func openTestDB(t *testing.T, databaseConfig config.DatabaseConfig) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(databaseConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := database.MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestIncrementDownloads(t *testing.T) {
+	for name, open := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			repository := NewShareRepository(open(t))
+			shareInfo := &model.Share{ID: "limited", Code: "limited", MaxDownloads: 3}
+			if err := repository.SaveShare(shareInfo); err != nil {
+				t.Fatal(err)
+			}
+
+			// 上限为3时前3次下载成功,第3次下载后分享过期
+			for i := 1; i <= 4; i++ {
+				ok, err := repository.IncrementDownloads(shareInfo.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := i <= 3; ok != want {
+					t.Fatalf("download %d: ok = %v, want %v", i, ok, want)
+				}
+
+				saved, err := repository.GetShareByCode(shareInfo.Code)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantStatus := model.SHARE_STATUS_USED
+				if i >= 3 {
+					wantStatus = model.SHARE_STATUS_EXPIRED
+				}
+				if saved.Status != wantStatus || saved.Downloads != min(int64(i), 3) {
+					t.Fatalf("after download %d: status = %d, downloads = %d", i, saved.Status, saved.Downloads)
+				}
+			}
+		})
+	}
+}
+
+func TestIncrementDownloadsUnlimited(t *testing.T) {
+	for name, open := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			repository := NewShareRepository(open(t))
+			shareInfo := &model.Share{ID: "unlimited", Code: "unlimited"}
+			if err := repository.SaveShare(shareInfo); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				if ok, err := repository.IncrementDownloads(shareInfo.ID); err != nil || !ok {
+					t.Fatalf("download %d: ok = %v, err = %v", i+1, ok, err)
+				}
+			}
+			saved, err := repository.GetShareByCode(shareInfo.Code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.Status != model.SHARE_STATUS_USED || saved.Downloads != 5 {
+				t.Errorf("status = %d, downloads = %d, want %d and 5", saved.Status, saved.Downloads, model.SHARE_STATUS_USED)
+			}
+		})
+	}
+}
+
+func TestGetReapCandidates(t *testing.T) {
+	for name, open := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			db := open(t)
+			repository := NewShareRepository(db)
+			now := time.Now().Truncate(time.Second)
+			before := now.Add(-time.Hour)
+			longAgo := now.Add(-2 * time.Hour)
+			recently := now.Add(-time.Minute)
+
+			shares := []model.Share{
+				{ID: "a-expired", File: "a", ExpiresAt: &longAgo},
+				{ID: "b-exhausted", File: "b", MaxDownloads: 1, Downloads: 1, UpdatedAt: longAgo},
+				{ID: "c-burned", File: "c", Status: model.SHARE_STATUS_EXPIRED, UpdatedAt: longAgo},
+				{ID: "d-expired-text", Text: "text", ExpiresAt: &longAgo},
+				{ID: "e-expired-items", ExpiresAt: &longAgo, Items: []model.ShareItem{{ID: "item", File: "e"}}},
+				// 以下分享不需要清理
+				{ID: "f-grace", File: "f", ExpiresAt: &recently},
+				{ID: "g-exhausted-grace", File: "g", MaxDownloads: 1, Downloads: 1, UpdatedAt: recently},
+				{ID: "h-forever", File: "h", UpdatedAt: longAgo},
+				{ID: "i-reaped", Status: model.SHARE_STATUS_EXPIRED, ExpiresAt: &longAgo, UpdatedAt: longAgo},
+			}
+			for i := range shares {
+				shares[i].Code = shares[i].ID
+				if err := repository.SaveShare(&shares[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// 分批查询,每批最多2个
+			var got []string
+			afterID := ""
+			for {
+				batch, err := repository.GetReapCandidates(before, afterID, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(batch) > 2 {
+					t.Fatalf("batch size = %d, want at most 2", len(batch))
+				}
+				for _, shareInfo := range batch {
+					got = append(got, shareInfo.ID)
+				}
+				if len(batch) < 2 {
+					break
+				}
+				afterID = batch[len(batch)-1].ID
+			}
+
+			want := []string{"a-expired", "b-exhausted", "c-burned", "d-expired-text", "e-expired-items"}
+			if !slices.Equal(got, want) {
+				t.Errorf("candidates = %v, want %v", got, want)
+			}
+		})
+	}
+}
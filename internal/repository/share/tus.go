@@ -0,0 +1,63 @@
+package share
+
+import (
+	"time"
+
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	"gorm.io/gorm"
+)
+
+type TusRepository struct {
+	db *gorm.DB
+}
+
+func NewTusRepository(db *gorm.DB) TusRepositoryInterface {
+	return &TusRepository{
+		db: db,
+	}
+}
+
+func (tusRepository *TusRepository) SaveUpload(upload *model.TusUpload) error {
+	return tusRepository.db.Create(upload).Error
+}
+
+func (tusRepository *TusRepository) GetUploadByID(id string) (*model.TusUpload, error) {
+	var upload model.TusUpload
+	if err := tusRepository.db.Where("id = ?", id).First(&upload).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil // 没有找到记录
+		}
+		return nil, err // 其他错误
+	}
+	return &upload, nil
+}
+
+func (tusRepository *TusRepository) UpdateOffset(id string, offset int64) error {
+	return tusRepository.db.Model(&model.TusUpload{}).
+		Where("id = ?", id).
+		Update("upload_offset", offset).Error
+}
+
+func (tusRepository *TusRepository) UpdateShareCode(id string, shareCode string) error {
+	return tusRepository.db.Model(&model.TusUpload{}).
+		Where("id = ?", id).
+		Update("share_code", shareCode).Error
+}
+
+func (tusRepository *TusRepository) GetStaleUploads(before time.Time, afterID string, limit int) ([]model.TusUpload, error) {
+	// 旧版本的任务没有更新时间,按创建时间判断
+	var uploads []model.TusUpload
+	if err := tusRepository.db.
+		Where("COALESCE(updated_at, created_at) < ?", before).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (tusRepository *TusRepository) DeleteUpload(id string) error {
+	return tusRepository.db.Where("id = ?", id).Delete(&model.TusUpload{}).Error
+}
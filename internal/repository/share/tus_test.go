@@ -0,0 +1,53 @@
+package share
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	model "github.com/WindyDante/toolpost/internal/model/share"
+)
+
+func TestGetStaleUploads(t *testing.T) {
+	for name, open := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			db := open(t)
+			repository := NewTusRepository(db)
+			now := time.Now().Truncate(time.Second)
+			longAgo := now.Add(-2 * time.Hour)
+
+			uploads := []model.TusUpload{
+				{ID: "a-stale", CreatedAt: longAgo, UpdatedAt: longAgo},
+				{ID: "b-finished", ShareCode: "code", CreatedAt: longAgo, UpdatedAt: longAgo},
+				{ID: "c-resumed", CreatedAt: longAgo, UpdatedAt: now},
+				{ID: "d-new"},
+				{ID: "e-legacy", CreatedAt: longAgo},
+			}
+			for i := range uploads {
+				if err := repository.SaveUpload(&uploads[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 旧版本的任务没有更新时间
+			if err := db.Model(&model.TusUpload{}).Where("id = ?", "e-legacy").UpdateColumn("updated_at", nil).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// 接收分片后更新时间刷新
+			if err := repository.UpdateOffset("a-stale", 10); err != nil {
+				t.Fatal(err)
+			}
+			stale, err := repository.GetStaleUploads(now.Add(-time.Hour), "", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, upload := range stale {
+				got = append(got, upload.ID)
+			}
+			if want := []string{"b-finished", "e-legacy"}; !slices.Equal(got, want) {
+				t.Errorf("stale uploads = %v, want %v", got, want)
+			}
+		})
+	}
+}
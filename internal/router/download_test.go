@@ -0,0 +1,86 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// rangeGet 带Range请求头下载,返回状态码和响应内容
+func rangeGet(t *testing.T, url, rangeHeader string) (int, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+func TestRangeDownloadCountsLimitedShare(t *testing.T) {
+	const content = "limited download content"
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "suffix", header: "bytes=-" + strconv.Itoa(len(content))},
+		{name: "suffix longer than file", header: "bytes=-1000"},
+		{name: "multi range", header: "bytes=1-,0-0"},
+		{name: "overlapping ranges", header: "bytes=1-,1-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			code, err := s.uploadForm(map[string]string{"maxDownloads": "1"}, "limited.txt", content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, downloadUrl := s.getJSON(t, s.url+"/api/share/"+code, "")
+			if result != 1 {
+				t.Fatalf("get share: code = %d", result)
+			}
+
+			status, _ := rangeGet(t, downloadUrl, tt.header)
+			if status != http.StatusPartialContent && status != http.StatusOK {
+				t.Fatalf("range download: status %d", status)
+			}
+			// 第一次请求已经取得完整文件,必须计入下载次数
+			if result, _ := s.getJSON(t, downloadUrl, ""); result == 1 {
+				t.Fatal("second download succeeded after the limit was reached")
+			}
+			if result, _ := s.getJSON(t, s.url+"/api/share/"+code, ""); result == 1 {
+				t.Error("share still available after the limit was reached")
+			}
+		})
+	}
+}
+
+func TestResumeDownloadNotCounted(t *testing.T) {
+	s := newTestServer(t)
+	const content = "resumed download content"
+	code, err := s.uploadForm(map[string]string{"maxDownloads": "1"}, "resumed.txt", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, downloadUrl := s.getJSON(t, s.url+"/api/share/"+code, "")
+
+	// 不包含第0个字节的Range请求是断点续传,不计入下载次数
+	for _, rangeHeader := range []string{"bytes=5-", "bytes=-3", "bytes=2-4,10-"} {
+		if status, _ := rangeGet(t, downloadUrl, rangeHeader); status != http.StatusPartialContent {
+			t.Fatalf("range %s: status %d", rangeHeader, status)
+		}
+	}
+	status, data := rangeGet(t, downloadUrl, "")
+	if status != http.StatusOK || string(data) != content {
+		t.Fatalf("full download: status %d, body %q", status, data)
+	}
+	if result, _ := s.getJSON(t, s.url+"/api/share/"+code, ""); result == 1 {
+		t.Error("share still available after the full download")
+	}
+}
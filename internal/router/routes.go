@@ -3,6 +3,7 @@ package router
 import (
 	"github.com/WindyDante/toolpost/internal/di"
 	"github.com/WindyDante/toolpost/internal/middleware"
+	ratelimitUtil "github.com/WindyDante/toolpost/internal/util/ratelimit"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 )
@@ -13,9 +14,28 @@ func SetupRoute(r *gin.Engine, h *di.Handlers) {
 
 	r.Use(middleware.Cors())
 
+	// 通过分享码访问的接口需要限流,防止暴力猜测分享码和密码
+	// 下载使用签名链接,只拦截已被锁定的客户端IP
+	rateLimitStore := ratelimitUtil.NewMemoryStore()
+	rateLimit := middleware.RateLimit(rateLimitStore)
+	lockout := middleware.Lockout(rateLimitStore)
+
 	shareGroup := r.Group("/api")
 	shareGroup.POST("/upload", h.ShareHandler.UploadAnyFile())
-	shareGroup.GET("/share/:code", h.ShareHandler.GetShareByCode())
-	shareGroup.GET("/share/detail/:code", h.ShareHandler.GetShareDetailByCode())
-	r.GET("/share/download", h.ShareHandler.DownloadFile())
+	shareGroup.GET("/share/:code", rateLimit, h.ShareHandler.GetShareByCode())
+	shareGroup.GET("/share/detail/:code", rateLimit, h.ShareHandler.GetShareDetailByCode())
+	shareGroup.GET("/share/items/:code", rateLimit, h.ShareHandler.GetShareItems())
+	shareGroup.GET("/share/raw/:code", rateLimit, h.ShareHandler.GetShareText())
+	shareGroup.GET("/share/preview/:code", rateLimit, h.ShareHandler.GetPreview())
+	r.GET("/share/download", lockout, h.ShareHandler.DownloadFile())
+	r.HEAD("/share/download", lockout, h.ShareHandler.DownloadFile())
+	r.GET("/share/download/archive", lockout, h.ShareHandler.DownloadArchive())
+
+	// 断点续传(tus 1.0)
+	tusGroup := r.Group("/api/tus")
+	tusGroup.OPTIONS("/", h.TusHandler.Options())
+	tusGroup.POST("/", h.TusHandler.CreateUpload())
+	tusGroup.HEAD("/:id", h.TusHandler.GetUploadOffset())
+	tusGroup.PATCH("/:id", h.TusHandler.UploadChunk())
+	tusGroup.DELETE("/:id", h.TusHandler.TerminateUpload())
 }
@@ -0,0 +1,612 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/WindyDante/toolpost/internal/database"
+	"github.com/WindyDante/toolpost/internal/di"
+	commonModel "github.com/WindyDante/toolpost/internal/model/common"
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	storageUtil "github.com/WindyDante/toolpost/internal/util/storage"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// testServer 使用临时目录中的sqlite数据库和本地存储启动完整的路由
+type testServer struct {
+	url        string
+	db         *gorm.DB
+	storageDir string
+	tusDir     string
+	previewDir string
+}
+
+// newTestServer configure 在创建服务前修改测试配置
+func newTestServer(t *testing.T, configure ...func(cfg *config.ConfigUtil)) *testServer {
+	t.Helper()
+	logUtil.InitLogger()
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	cfg, err := config.Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.Local.Path = filepath.Join(dir, "share")
+	cfg.Upload.TusPath = filepath.Join(dir, "tus")
+	cfg.Preview.CachePath = filepath.Join(dir, "preview")
+	cfg.Reaper.GracePeriod = 0
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	config.Config = cfg
+
+	// 使用文件数据库,并发请求使用多个连接,与正式运行时的锁行为一致
+	db, err := database.Open(config.DatabaseConfig{
+		Type:         database.DATABASE_TYPE_SQLITE,
+		Path:         filepath.Join(dir, "data", "share.db"),
+		MaxOpenConns: 20,
+		MaxIdleConns: 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers, err := di.BuildHandler(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	SetupRoute(engine, handlers)
+	server := httptest.NewServer(engine)
+	t.Cleanup(func() {
+		server.Close()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return &testServer{
+		url:        server.URL,
+		db:         db,
+		storageDir: cfg.Storage.Local.Path,
+		tusDir:     cfg.Upload.TusPath,
+		previewDir: cfg.Preview.CachePath,
+	}
+}
+
+// upload 上传一个文件,返回访问码
+func (s *testServer) upload(name, content string) (string, error) {
+	return s.uploadForm(nil, name, content)
+}
+
+// uploadForm 上传一个文件并附带表单字段,返回访问码
+func (s *testServer) uploadForm(fields map[string]string, name, content string) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	resp, err := http.Post(s.url+"/api/upload", writer.FormDataContentType(), &body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data struct {
+			Code string `json:"code"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || result.Code != 1 {
+		return "", fmt.Errorf("upload failed: status %d, %s", resp.StatusCode, result.Msg)
+	}
+	return result.Data.Code, nil
+}
+
+// parallelUpload 并发上传count次相同的内容,返回所有访问码
+func (s *testServer) parallelUpload(t *testing.T, count int, content string) []string {
+	t.Helper()
+	codes := make([]string, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i], errs[i] = s.upload(fmt.Sprintf("file-%d.txt", i), content)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("upload %d: %v", i, err)
+		}
+	}
+	return codes
+}
+
+func (s *testServer) blobs(t *testing.T) []model.Blob {
+	t.Helper()
+	var blobs []model.Blob
+	if err := s.db.Find(&blobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	return blobs
+}
+
+// storedFiles 本地存储中的文件,不包括临时文件和数据密钥文件
+func (s *testServer) storedFiles(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(s.storageDir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".tmp_") || strings.HasSuffix(name, storageUtil.ENVELOPE_SUFFIX) {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files
+}
+
+// expire 将访问码对应的分享设置为已过期
+func (s *testServer) expire(t *testing.T, codes []string) {
+	t.Helper()
+	if err := s.db.Model(&model.Share{}).
+		Where("code IN ?", codes).
+		Update("expires_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *testServer) reap(t *testing.T) {
+	t.Helper()
+	reaper, err := di.BuildReaper(s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reaper.Reap()
+}
+
+func TestParallelUploadDeduplicates(t *testing.T) {
+	s := newTestServer(t)
+	const uploads = 30
+	codes := s.parallelUpload(t, uploads, "same content")
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if seen[code] {
+			t.Fatalf("duplicate access code %s", code)
+		}
+		seen[code] = true
+	}
+
+	blobs := s.blobs(t)
+	if len(blobs) != 1 || blobs[0].RefCount != uploads {
+		t.Fatalf("blobs = %+v, want one blob with ref count %d", blobs, uploads)
+	}
+	// 所有分享都指向先保存的文件,重复写入的文件已被删除
+	var shares []model.Share
+	if err := s.db.Where("code IN ?", codes).Find(&shares).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, shareInfo := range shares {
+		if shareInfo.File != blobs[0].File {
+			t.Errorf("share %s references %s, want %s", shareInfo.Code, shareInfo.File, blobs[0].File)
+		}
+	}
+	if files := s.storedFiles(t); len(files) != 1 || files[0] != blobs[0].File {
+		t.Errorf("stored files = %v, want only %s", files, blobs[0].File)
+	}
+}
+
+func TestReapReleasesReferences(t *testing.T) {
+	s := newTestServer(t)
+	codes := s.parallelUpload(t, 10, "reaped content")
+	other := s.parallelUpload(t, 3, "other content")
+
+	// 过期一半的分享后文件仍被其余分享引用
+	s.expire(t, codes[:5])
+	s.reap(t)
+	blobs := s.blobs(t)
+	if len(blobs) != 2 {
+		t.Fatalf("blobs = %+v, want 2", blobs)
+	}
+	for _, blob := range blobs {
+		want := int64(5)
+		if blob.RefCount == 3 {
+			want = 3
+		}
+		if blob.RefCount != want {
+			t.Errorf("blob %s ref count = %d, want %d", blob.Hash, blob.RefCount, want)
+		}
+	}
+	if files := s.storedFiles(t); len(files) != 2 {
+		t.Fatalf("stored files = %v, want 2", files)
+	}
+
+	// 全部过期后删除引用记录和文件,其他内容不受影响
+	s.expire(t, codes[5:])
+	s.reap(t)
+	blobs = s.blobs(t)
+	if len(blobs) != 1 || blobs[0].RefCount != int64(len(other)) {
+		t.Fatalf("blobs = %+v, want only the other content with ref count %d", blobs, len(other))
+	}
+	if files := s.storedFiles(t); len(files) != 1 || files[0] != blobs[0].File {
+		t.Errorf("stored files = %v, want only %s", files, blobs[0].File)
+	}
+}
+
+func TestConcurrentReapAndUpload(t *testing.T) {
+	s := newTestServer(t)
+	const content = "contended content"
+	expired := s.parallelUpload(t, 10, content)
+	s.expire(t, expired)
+
+	// 多个清理任务与上传相同内容同时进行,每个引用只能被释放一次,
+	// 仍被引用的文件不能被删除
+	const uploads = 10
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.reap(t)
+		}()
+	}
+	codes := s.parallelUpload(t, uploads, content)
+	wg.Wait()
+	s.reap(t)
+
+	blobs := s.blobs(t)
+	if len(blobs) != 1 || blobs[0].RefCount != uploads {
+		t.Fatalf("blobs = %+v, want one blob with ref count %d", blobs, uploads)
+	}
+	var shares []model.Share
+	if err := s.db.Where("code IN ?", codes).Find(&shares).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, shareInfo := range shares {
+		if shareInfo.File != blobs[0].File {
+			t.Errorf("share %s references %s, want %s", shareInfo.Code, shareInfo.File, blobs[0].File)
+		}
+	}
+	if files := s.storedFiles(t); len(files) != 1 || files[0] != blobs[0].File {
+		t.Errorf("stored files = %v, want only %s", files, blobs[0].File)
+	}
+}
+
+func TestUploadLegacyExpireUnit(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		unit string
+		want time.Duration
+	}{
+		{unit: "1", want: 2 * time.Minute},
+		{unit: "2", want: 2 * time.Hour},
+		{unit: "3", want: 2 * 24 * time.Hour},
+		{unit: "3600", want: 2 * time.Hour},
+		{unit: "86400", want: 2 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		code, err := s.uploadForm(map[string]string{"expireTime": "2", "expireUnit": tt.unit}, "expire.txt", "expire "+tt.unit)
+		if err != nil {
+			t.Fatalf("expireUnit %s: %v", tt.unit, err)
+		}
+		var shareInfo model.Share
+		if err := s.db.Where("code = ?", code).First(&shareInfo).Error; err != nil {
+			t.Fatal(err)
+		}
+		if shareInfo.ExpiresAt == nil {
+			t.Fatalf("expireUnit %s: expires_at not set", tt.unit)
+		}
+		if got := shareInfo.ExpiresAt.Sub(start); got < tt.want-time.Second || got > tt.want+5*time.Second {
+			t.Errorf("expireUnit %s: expires in %v, want %v", tt.unit, got, tt.want)
+		}
+	}
+
+	if _, err := s.uploadForm(map[string]string{"expireTime": "2", "expireUnit": "42"}, "expire.txt", "unknown unit"); err == nil {
+		t.Error("unknown expireUnit: expected the upload to be rejected")
+	}
+}
+
+// enableEncryption 开启加密,密钥文件保存在临时目录中
+func enableEncryption(t *testing.T) func(cfg *config.ConfigUtil) {
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	return func(cfg *config.ConfigUtil) {
+		cfg.Encryption.Enabled = true
+		cfg.Encryption.KeyFile = keyFile
+		cfg.Encryption.ChunkSize = 1024
+	}
+}
+
+// assertNoPlaintext 目录中的文件都不包含明文内容,并且存在数据密钥文件
+func assertNoPlaintext(t *testing.T, dir string, plain []byte) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelopes := 0
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), storageUtil.ENVELOPE_SUFFIX) {
+			envelopes++
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, plain) {
+			t.Errorf("%s contains plaintext", filepath.Join(dir, entry.Name()))
+		}
+	}
+	if envelopes == 0 {
+		t.Errorf("no data keys in %s", dir)
+	}
+}
+
+func TestEncryptedPreviewCache(t *testing.T) {
+	s := newTestServer(t, enableEncryption(t))
+
+	// 生成内容不会被压缩成重复数据的PNG图片
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	code, err := s.upload("image.png", buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次请求生成并缓存缩略图,第二次请求读取缓存
+	var thumbnails [][]byte
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(s.url + "/api/share/preview/" + code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("preview: status %d, %s", resp.StatusCode, data)
+		}
+		thumbnails = append(thumbnails, data)
+	}
+	if !bytes.Equal(thumbnails[0], thumbnails[1]) {
+		t.Error("cached thumbnail differs from the generated one")
+	}
+	assertNoPlaintext(t, s.previewDir, thumbnails[0])
+}
+
+// createTus 创建断点续传任务,返回任务地址
+func (s *testServer) createTus(t *testing.T, name string, length int) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, s.url+"/api/tus/", nil)
+	req.Header.Set("Tus-Resumable", model.TUS_VERSION)
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(name)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+// patchTus 从offset开始上传分片,返回上传完成后的访问码
+func (s *testServer) patchTus(t *testing.T, location string, offset int, data []byte) string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPatch, location, bytes.NewReader(data))
+	req.Header.Set("Tus-Resumable", model.TUS_VERSION)
+	req.Header.Set("Content-Type", model.TUS_CONTENT_TYPE)
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("patch at %d: status %d", offset, resp.StatusCode)
+	}
+	return resp.Header.Get("Upload-Share-Code")
+}
+
+// headTus 查询断点续传任务,返回状态码
+func (s *testServer) headTus(t *testing.T, location string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodHead, location, nil)
+	req.Header.Set("Tus-Resumable", model.TUS_VERSION)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestEncryptedTusChunks(t *testing.T) {
+	s := newTestServer(t, enableEncryption(t))
+	content := []byte(strings.Repeat("resumable upload content ", 200))
+	location := s.createTus(t, "upload.txt", len(content))
+
+	// 分两次上传,第一次上传后检查磁盘上的分片
+	half := len(content) / 2
+	s.patchTus(t, location, 0, content[:half])
+	assertNoPlaintext(t, s.tusDir, content[:64])
+
+	code := s.patchTus(t, location, half, content[half:])
+	if code == "" {
+		t.Fatal("no share code after the last chunk")
+	}
+	if entries, _ := os.ReadDir(s.tusDir); len(entries) != 0 {
+		t.Errorf("chunks left after the upload finished: %v", entries)
+	}
+
+	// 合并后的文件与上传的内容一致
+	var shareInfo model.Share
+	if err := s.db.Where("code = ?", code).First(&shareInfo).Error; err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	if shareInfo.Hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("hash = %s, want %x", shareInfo.Hash, sum)
+	}
+}
+
+func TestReapStaleTusUploads(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.ConfigUtil) {
+		cfg.Reaper.TusExpire = 3600
+	})
+	stale := s.createTus(t, "stale.txt", 100)
+	s.patchTus(t, stale, 0, bytes.Repeat([]byte("s"), 40))
+	active := s.createTus(t, "active.txt", 100)
+	s.patchTus(t, active, 0, bytes.Repeat([]byte("a"), 40))
+
+	// 超过保留时间没有继续上传的任务
+	staleID := filepath.Base(stale)
+	if err := s.db.Model(&model.TusUpload{}).
+		Where("id = ?", staleID).
+		UpdateColumn("updated_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.reap(t)
+
+	if status := s.headTus(t, stale); status != http.StatusNotFound {
+		t.Errorf("stale upload: status %d, want %d", status, http.StatusNotFound)
+	}
+	if files, _ := filepath.Glob(filepath.Join(s.tusDir, staleID+"*")); len(files) != 0 {
+		t.Errorf("stale chunks left: %v", files)
+	}
+
+	// 未过期的任务可以继续上传
+	if status := s.headTus(t, active); status != http.StatusOK {
+		t.Fatalf("active upload: status %d, want %d", status, http.StatusOK)
+	}
+	if code := s.patchTus(t, active, 40, bytes.Repeat([]byte("a"), 60)); code == "" {
+		t.Error("no share code after the last chunk")
+	}
+}
+
+// getJSON 请求返回统一响应格式的接口,password不为空时通过请求头传递访问密码
+func (s *testServer) getJSON(t *testing.T, url, password string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if password != "" {
+		req.Header.Set("X-Share-Password", password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Code int    `json:"code"`
+		Data string `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Code, result.Data
+}
+
+func TestSharePasswordOnlyFromHeader(t *testing.T) {
+	s := newTestServer(t)
+	const content = "protected content"
+	code, err := s.uploadForm(map[string]string{"password": "secret"}, "protected.txt", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 查询参数中的密码不被接受
+	if result, _ := s.getJSON(t, s.url+"/api/share/"+code+"?password=secret", ""); result != commonModel.PASSWORD_REQUIRED_CODE {
+		t.Errorf("password in query: code = %d, want %d", result, commonModel.PASSWORD_REQUIRED_CODE)
+	}
+	if result, _ := s.getJSON(t, s.url+"/api/share/"+code, "wrong"); result != commonModel.PASSWORD_INCORRECT_CODE {
+		t.Errorf("wrong password: code = %d, want %d", result, commonModel.PASSWORD_INCORRECT_CODE)
+	}
+	result, downloadUrl := s.getJSON(t, s.url+"/api/share/"+code, "secret")
+	if result != 1 || downloadUrl == "" {
+		t.Fatalf("password in header: code = %d, url = %q", result, downloadUrl)
+	}
+
+	// 签名的下载链接不需要密码
+	resp, err := http.Get(downloadUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != content {
+		t.Errorf("download: status %d, body %q, want %q", resp.StatusCode, data, content)
+	}
+
+	// 没有有效签名时即使带上密码也不能下载
+	forged := strings.Replace(downloadUrl, "key=", "key=x", 1)
+	if result, _ := s.getJSON(t, forged, "secret"); result == 1 {
+		t.Error("download with an invalid key succeeded")
+	}
+}
+
+func TestPDFPreviewUnsupported(t *testing.T) {
+	s := newTestServer(t)
+	code, err := s.upload("document.pdf", "%PDF-1.4\n%%EOF\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(s.url + "/api/share/preview/" + code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("pdf preview: status %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+}
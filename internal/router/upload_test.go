@@ -0,0 +1,32 @@
+package router
+
+import "testing"
+
+func TestRejectedCustomCodeRemovesFiles(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := s.uploadForm(map[string]string{"code": "mine"}, "a.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 访问码已被使用或格式不正确时,已写入存储的文件被删除
+	for _, code := range []string{"mine", "a b", "x"} {
+		_, err := s.uploadForm(map[string]string{"code": code}, "b.txt", "second "+code)
+		if err == nil {
+			t.Errorf("upload with code %q succeeded", code)
+		}
+		if files := s.storedFiles(t); len(files) != 1 {
+			t.Errorf("after rejected code %q stored files = %v, want 1", code, files)
+		}
+	}
+
+	code, err := s.uploadForm(map[string]string{"code": "yours"}, "b.txt", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "yours" {
+		t.Errorf("custom code = %q, want yours", code)
+	}
+	if files := s.storedFiles(t); len(files) != 2 {
+		t.Errorf("stored files = %v, want 2", files)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	model "github.com/WindyDante/toolpost/internal/model/common"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	NETWORK_TCP  = "tcp"
+	NETWORK_UNIX = "unix"
+
+	DEFAULT_SOCKET_MODE = 0660
+)
+
+var (
+	ErrNetworkUnsupported = errors.New(model.NETWORK_UNSUPPORTED)
+	ErrInvalidSocketMode  = errors.New(model.INVALID_SOCKET_MODE)
+	ErrTLSCertRequired    = errors.New(model.TLS_CERT_REQUIRED)
+)
+
+// newListener 根据配置监听 host:port 或 unix socket
+func newListener(serverConfig config.ServerConfig) (net.Listener, error) {
+	switch serverConfig.Network {
+	case NETWORK_TCP, "":
+		return net.Listen(NETWORK_TCP, net.JoinHostPort(serverConfig.Host, serverConfig.Port))
+	case NETWORK_UNIX:
+		return listenUnix(serverConfig.Socket, serverConfig.SocketMode)
+	}
+	return nil, errors.New(model.NETWORK_UNSUPPORTED + ": " + serverConfig.Network)
+}
+
+// listenUnix 监听unix socket,删除上次异常退出时残留的socket文件
+// 关闭监听时socket文件会被自动删除
+func listenUnix(path, mode string) (net.Listener, error) {
+	fileMode := os.FileMode(DEFAULT_SOCKET_MODE)
+	if mode != "" {
+		value, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return nil, ErrInvalidSocketMode
+		}
+		fileMode = os.FileMode(value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// 只删除socket文件,避免配置错误时删除普通文件
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen(NETWORK_UNIX, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, fileMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// newHandler 未启用TLS并开启h2c时支持HTTP/2明文连接
+func newHandler(serverConfig config.ServerConfig, handler http.Handler) http.Handler {
+	if serverConfig.H2C && !serverConfig.TLS.Enabled {
+		return h2c.NewHandler(handler, &http2.Server{})
+	}
+	return handler
+}
+
+// newTLSConfig 根据配置创建TLS配置,证书在握手时按间隔检查是否更新
+func newTLSConfig(tlsConfig config.ServerTLSConfig) (*tls.Config, error) {
+	if tlsConfig.CertFile == "" || tlsConfig.KeyFile == "" {
+		return nil, ErrTLSCertRequired
+	}
+	reloader := &certReloader{
+		certFile: tlsConfig.CertFile,
+		keyFile:  tlsConfig.KeyFile,
+		interval: time.Duration(tlsConfig.ReloadInterval) * time.Second,
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
+
+// certReloader 证书文件更新后自动加载新的证书,更新证书时不需要重启服务
+// 新证书加载失败时继续使用原来的证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.interval > 0 && time.Since(c.checkedAt) >= c.interval {
+		c.checkedAt = time.Now()
+		if modTime := c.latestModTime(); modTime.After(c.modTime) {
+			if err := c.loadLocked(); err != nil {
+				logUtil.Logger.Warn("重新加载TLS证书失败,继续使用原来的证书", zap.Error(err))
+			} else {
+				logUtil.Logger.Info("已重新加载TLS证书", zap.String("certFile", c.certFile))
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+func (c *certReloader) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt = time.Now()
+	return c.loadLocked()
+}
+
+func (c *certReloader) loadLocked() error {
+	// 先读取修改时间,加载过程中文件再次更新时下次检查会重新加载
+	modTime := c.latestModTime()
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// latestModTime 证书和私钥文件中较晚的修改时间
+func (c *certReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
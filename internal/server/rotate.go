@@ -0,0 +1,141 @@
+package server
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/WindyDante/toolpost/internal/database"
+	model "github.com/WindyDante/toolpost/internal/model/common"
+	"github.com/WindyDante/toolpost/internal/repository/share"
+	util "github.com/WindyDante/toolpost/internal/util/err"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	storageUtil "github.com/WindyDante/toolpost/internal/util/storage"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// RotateMasterKey 使用新的主密钥重新加密所有文件的数据密钥,文件内容不需要重新加密
+// 包括分享文件、未完成的断点续传分片和缩略图缓存
+// 使用密钥文件时自动生成新的主密钥,全部完成后从密钥文件中删除旧的主密钥
+// 使用配置中的主密钥时,需要先将新的主密钥添加到 masterKeys 的第一位,完成后再删除旧的主密钥
+// 服务只在启动时读取主密钥,轮换前需要停止服务
+func RotateMasterKey() {
+	logUtil.InitLogger()
+	config.LoadConfig()
+	database.InitDatabase()
+
+	if err := rotateMasterKey(database.DB); err != nil {
+		handleRotateError(err)
+	}
+}
+
+// rotateMasterKey 生成新的主密钥并重新加密数据密钥,全部成功后才从密钥文件中删除旧的主密钥
+func rotateMasterKey(db *gorm.DB) error {
+	encryptionConfig := config.Config.Encryption
+	var rotatedKeys []string
+	if len(encryptionConfig.MasterKeys) == 0 {
+		keys, err := storageUtil.ReadKeyFile(encryptionConfig.KeyFile)
+		if err != nil {
+			return err
+		}
+		newKey, err := storageUtil.GenerateMasterKey()
+		if err != nil {
+			return err
+		}
+		// 先保存新的主密钥,中途失败时旧的主密钥仍在密钥文件中
+		rotatedKeys = []string{newKey}
+		if err := storageUtil.WriteKeyFile(encryptionConfig.KeyFile, append(rotatedKeys, keys...)); err != nil {
+			return err
+		}
+	}
+
+	files, rotated, err := rewrapFiles(db)
+	if err != nil {
+		return err
+	}
+
+	if rotatedKeys != nil {
+		if err := storageUtil.WriteKeyFile(encryptionConfig.KeyFile, rotatedKeys); err != nil {
+			return err
+		}
+	}
+	logUtil.Logger.Info("加密主密钥轮换完成", zap.Int("files", files), zap.Int("rotated", rotated))
+	return nil
+}
+
+// rewrapFiles 使用当前主密钥重新加密所有数据密钥,返回检查的文件数和重新加密的文件数
+// 除了分享文件,未完成的断点续传分片和缩略图缓存也使用相同的主密钥加密,需要一起处理
+func rewrapFiles(db *gorm.DB) (int, int, error) {
+	backend, err := storageUtil.NewBackend()
+	if err != nil {
+		return 0, 0, err
+	}
+	storage, err := storageUtil.NewEncryptedStorageFromConfig(backend)
+	if err != nil {
+		return 0, 0, err
+	}
+	keys, err := share.NewShareRepository(db).GetFileKeys()
+	if err != nil {
+		return 0, 0, err
+	}
+	rotated, err := rewrapKeys(storage, keys)
+	if err != nil {
+		return 0, 0, err
+	}
+	files := len(keys)
+
+	for _, dir := range []string{config.Config.Upload.TusPath, config.Config.Preview.CachePath} {
+		local, err := storageUtil.NewLocalStorage(dir)
+		if err != nil {
+			return 0, 0, err
+		}
+		scratch, err := storageUtil.NewEncryptedStorageFromConfig(local)
+		if err != nil {
+			return 0, 0, err
+		}
+		// 本地目录中的每个数据密钥文件对应一个加密文件
+		envelopes, err := filepath.Glob(filepath.Join(dir, "*"+storageUtil.ENVELOPE_SUFFIX))
+		if err != nil {
+			return 0, 0, err
+		}
+		keys := make([]string, 0, len(envelopes))
+		for _, envelope := range envelopes {
+			keys = append(keys, strings.TrimSuffix(filepath.Base(envelope), storageUtil.ENVELOPE_SUFFIX))
+		}
+		n, err := rewrapKeys(scratch, keys)
+		if err != nil {
+			return 0, 0, err
+		}
+		files += len(keys)
+		rotated += n
+	}
+	return files, rotated, nil
+}
+
+// rewrapKeys 重新加密 keys 对应文件的数据密钥,期间被删除的文件直接跳过
+func rewrapKeys(storage *storageUtil.EncryptedStorage, keys []string) (int, error) {
+	rotated := 0
+	for _, key := range keys {
+		ok, err := storage.Rewrap(key)
+		if errors.Is(err, storageUtil.ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			logUtil.Logger.Error("重新加密数据密钥失败", zap.String("file", key), zap.Error(err))
+			return rotated, err
+		}
+		if ok {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+func handleRotateError(err error) {
+	util.HandlePanicError(&model.ServerError{
+		Msg: model.ROTATE_KEY_PANIC,
+		Err: err,
+	})
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/WindyDante/toolpost/internal/database"
+	shareModel "github.com/WindyDante/toolpost/internal/model/share"
+	"github.com/WindyDante/toolpost/internal/repository/share"
+	shareService "github.com/WindyDante/toolpost/internal/service/share"
+	codeUtil "github.com/WindyDante/toolpost/internal/util/code"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	previewUtil "github.com/WindyDante/toolpost/internal/util/preview"
+	storageUtil "github.com/WindyDante/toolpost/internal/util/storage"
+	"gorm.io/gorm"
+)
+
+// newRotateTest 使用临时目录和加密存储初始化配置与数据库
+func newRotateTest(t *testing.T) *gorm.DB {
+	t.Helper()
+	logUtil.InitLogger()
+
+	dir := t.TempDir()
+	cfg, err := config.Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.Local.Path = filepath.Join(dir, "share")
+	cfg.Upload.TusPath = filepath.Join(dir, "tus")
+	cfg.Preview.CachePath = filepath.Join(dir, "preview")
+	cfg.Encryption.Enabled = true
+	cfg.Encryption.KeyFile = filepath.Join(dir, "master.key")
+	cfg.Encryption.ChunkSize = 1024
+	config.Config = cfg
+
+	db, err := database.Open(config.DatabaseConfig{
+		Type: database.DATABASE_TYPE_SQLITE,
+		Path: filepath.Join(dir, "data", "share.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// newTusService 与服务启动时一样从配置读取主密钥创建断点续传服务
+func newTusService(t *testing.T, db *gorm.DB) (shareService.TusServiceInterface, storageUtil.Storage) {
+	t.Helper()
+	storage, err := storageUtil.NewStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := codeUtil.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tus, err := shareService.NewTusService(share.NewTusRepository(db), share.NewShareRepository(db), storage, codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tus, storage
+}
+
+func TestRotateMasterKeyDuringTusUpload(t *testing.T) {
+	db := newRotateTest(t)
+	content := bytes.Repeat([]byte("rotate the master key while uploading "), 200)
+	half := int64(len(content) / 2)
+
+	tus, _ := newTusService(t, db)
+	upload, err := tus.CreateUpload(shareModel.TusUpload{
+		Length:   int64(len(content)),
+		FileName: "rotate.txt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tus.WriteChunk(upload.ID, 0, bytes.NewReader(content[:half])); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := previewUtil.NewCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnail := []byte("cached thumbnail")
+	if err := cache.Put("hash", 64, thumbnail); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKeys, err := storageUtil.ReadKeyFile(config.Config.Encryption.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rotateMasterKey(db); err != nil {
+		t.Fatal(err)
+	}
+	newKeys, err := storageUtil.ReadKeyFile(config.Config.Encryption.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newKeys) != 1 || newKeys[0] == oldKeys[0] {
+		t.Fatalf("key file after rotation = %v, want only a new key", newKeys)
+	}
+
+	// 重启后只有新的主密钥,已接收的分片和缓存的缩略图都必须能解密
+	tus, storage := newTusService(t, db)
+	vo, err := tus.WriteChunk(upload.ID, half, bytes.NewReader(content[half:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vo.ShareCode == "" {
+		t.Fatal("upload did not finish")
+	}
+	keys, err := share.NewShareRepository(db).GetFileKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("stored files = %v, want 1", keys)
+	}
+	r, err := storage.Get(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, want %d", len(got), len(content))
+	}
+
+	cache, err = previewUtil.NewCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := cache.Get("hash", 64)
+	if err != nil {
+		t.Fatalf("cached thumbnail after rotation: %v", err)
+	}
+	if !bytes.Equal(cached, thumbnail) {
+		t.Errorf("cached thumbnail = %q, want %q", cached, thumbnail)
+	}
+}
@@ -1,7 +1,12 @@
 package server
 
 import (
-	"fmt"
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/WindyDante/toolpost/internal/config"
 	"github.com/WindyDante/toolpost/internal/database"
@@ -10,11 +15,23 @@ import (
 	"github.com/WindyDante/toolpost/internal/router"
 	util "github.com/WindyDante/toolpost/internal/util/err"
 	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	storageUtil "github.com/WindyDante/toolpost/internal/util/storage"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
+const DEFAULT_SHUTDOWN_TIMEOUT = 30 // 未配置时关闭服务等待请求结束的时间(秒)
+
 type Server struct {
-	GinEngine *gin.Engine // 封装Gin引擎
+	GinEngine  *gin.Engine // 封装Gin引擎
+	httpServer *http.Server
+	hooks      []shutdownHook
+}
+
+// shutdownHook 关闭服务时执行的清理操作,按注册的相反顺序执行
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
 }
 
 func New() *Server {
@@ -24,10 +41,16 @@ func New() *Server {
 	}
 }
 
+// OnShutdown 注册关闭服务时的清理操作,后注册的先执行
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, shutdownHook{name: name, fn: fn})
+}
+
 func (s *Server) Init() {
 	logUtil.InitLogger() // 初始化日志记录
 
 	config.LoadConfig() // 加载配置文件
+	s.watchConfig()
 
 	if config.Config.Server.Mode == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -35,7 +58,25 @@ func (s *Server) Init() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// 默认不信任任何代理,避免客户端伪造X-Forwarded-For绕过按IP的限流
+	if err := s.GinEngine.SetTrustedProxies(config.Config.Server.TrustedProxies); err != nil {
+		util.HandlePanicError(&model.ServerError{
+			Msg: model.INVALID_CONFIG_PANIC,
+			Err: err,
+		})
+	}
+	s.GinEngine.TrustedPlatform = config.Config.Server.TrustedPlatform
+
 	database.InitDatabase()
+	s.OnShutdown("database", func(ctx context.Context) error {
+		return database.Close()
+	})
+
+	// 清理上次异常退出时残留的临时文件,关闭服务时再清理一次被中断的写入
+	if err := removeTempFiles(context.Background()); err != nil {
+		logUtil.Logger.Warn("删除残留的临时文件失败", zap.Error(err))
+	}
+	s.OnShutdown("temp files", removeTempFiles)
 
 	handlers, err := di.BuildHandler(database.DB)
 	if err != nil {
@@ -46,11 +87,155 @@ func (s *Server) Init() {
 	}
 
 	router.SetupRoute(s.GinEngine, handlers) // 设置路由
+
+	// 启动过期分享清理任务
+	reaper, err := di.BuildReaper(database.DB)
+	if err != nil {
+		util.HandlePanicError(&model.ServerError{
+			Msg: model.INIT_REAPER_PANIC,
+			Err: err,
+		})
+	}
+	reaper.Start()
+	s.OnShutdown("reaper", reaper.Stop)
+}
+
+// watchConfig 应用配置中的日志级别并监听配置文件,文件修改后热加载可以在运行时生效的配置项
+func (s *Server) watchConfig() {
+	setLogLevel(config.Current())
+	config.OnReload(setLogLevel)
+
+	stop, err := config.Watch()
+	if err != nil {
+		logUtil.Logger.Warn("监听配置文件失败,修改配置后需要重启服务", zap.String("dir", config.Dir()), zap.Error(err))
+		return
+	}
+	s.OnShutdown("config watcher", func(ctx context.Context) error {
+		return stop()
+	})
 }
 
+func setLogLevel(c *config.ConfigUtil) {
+	if err := logUtil.SetLevel(c.Server.LogLevel); err != nil {
+		logUtil.Logger.Warn("设置日志级别失败", zap.String("level", c.Server.LogLevel), zap.Error(err))
+	}
+}
+
+// Start 启动服务并阻塞,收到SIGINT或SIGTERM后停止接受新的请求,等待进行中的请求结束后退出
 func (s *Server) Start() {
-	port := config.Config.Server.Port
-	if err := s.GinEngine.Run(":" + port); err != nil {
-		panic(fmt.Sprintf("Failed to start server on port %s: %v", port, err))
+	serverConfig := config.Config.Server
+	s.httpServer = &http.Server{
+		Handler:           newHandler(serverConfig, s.GinEngine),
+		ReadHeaderTimeout: seconds(serverConfig.ReadHeaderTimeout),
+		ReadTimeout:       seconds(serverConfig.ReadTimeout),
+		WriteTimeout:      seconds(serverConfig.WriteTimeout),
+		IdleTimeout:       seconds(serverConfig.IdleTimeout),
+	}
+
+	listener, err := newListener(serverConfig)
+	if err == nil && serverConfig.TLS.Enabled {
+		s.httpServer.TLSConfig, err = newTLSConfig(serverConfig.TLS)
+		if err != nil {
+			listener.Close()
+		}
 	}
+	if err != nil {
+		util.HandlePanicError(&model.ServerError{
+			Msg: model.INIT_LISTENER_PANIC,
+			Err: err,
+		})
+	}
+	logUtil.Logger.Info("服务已启动",
+		zap.String("address", listener.Addr().String()),
+		zap.Bool("tls", serverConfig.TLS.Enabled),
+		zap.Bool("h2c", serverConfig.H2C && !serverConfig.TLS.Enabled))
+
+	serveErr := make(chan error, 1)
+	go func() {
+		// 证书由TLSConfig提供,ServeTLS同时会启用HTTP/2
+		if serverConfig.TLS.Enabled {
+			serveErr <- s.httpServer.ServeTLS(listener, "", "")
+			return
+		}
+		serveErr <- s.httpServer.Serve(listener)
+	}()
+
+	quit := make(chan os.Signal, 2)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		util.HandlePanicError(&model.ServerError{
+			Msg: model.INIT_LISTENER_PANIC,
+			Err: err,
+		})
+	case sig := <-quit:
+		logUtil.Logger.Info("收到退出信号,开始关闭服务", zap.String("signal", sig.String()))
+	}
+
+	// 关闭过程中再次收到信号时立即退出
+	go func() {
+		<-quit
+		logUtil.Logger.Warn("再次收到退出信号,立即退出")
+		os.Exit(1)
+	}()
+	s.Shutdown()
+}
+
+// Shutdown 停止接受新的请求,在配置的时间内等待进行中的请求结束,然后依次执行清理操作
+func (s *Server) Shutdown() {
+	timeout := config.Config.Server.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DEFAULT_SHUTDOWN_TIMEOUT
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), seconds(timeout))
+	defer cancel()
+
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			// 超时后强制关闭剩余的连接,被中断的上传由存储删除不完整的文件
+			logUtil.Logger.Warn("等待请求结束超时,强制关闭连接", zap.Error(err))
+			s.httpServer.Close()
+		}
+	}
+
+	// 请求已全部结束或被中断,清理操作使用新的期限
+	hookCtx, hookCancel := context.WithTimeout(context.Background(), seconds(timeout))
+	defer hookCancel()
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		hook := s.hooks[i]
+		if err := hook.fn(hookCtx); err != nil {
+			logUtil.Logger.Warn("关闭服务时清理失败", zap.String("hook", hook.name), zap.Error(err))
+		}
+	}
+
+	logUtil.Logger.Info("服务已关闭")
+	logUtil.Logger.Sync()
+}
+
+// removeTempFiles 删除本地存储、断点续传分片和缩略图缓存中残留的临时文件
+func removeTempFiles(ctx context.Context) error {
+	dirs := []string{config.Config.Upload.TusPath, config.Config.Preview.CachePath}
+	storageConfig := config.Config.Storage
+	if storageConfig.Type == storageUtil.STORAGE_TYPE_LOCAL || storageConfig.Type == "" {
+		dirs = append(dirs, storageConfig.Local.Path)
+	}
+
+	removed := 0
+	var err error
+	for _, dir := range dirs {
+		var n int
+		n, err = storageUtil.RemoveTempFiles(dir)
+		removed += n
+		if err != nil {
+			break
+		}
+	}
+	if removed > 0 {
+		logUtil.Logger.Info("已删除残留的临时文件", zap.Int("files", removed))
+	}
+	return err
+}
+
+func seconds(value int64) time.Duration {
+	return time.Duration(value) * time.Second
 }
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+)
+
+func TestRemoveTempFiles(t *testing.T) {
+	logUtil.InitLogger()
+	dir := t.TempDir()
+	cfg, err := config.Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.Local.Path = filepath.Join(dir, "share")
+	cfg.Upload.TusPath = filepath.Join(dir, "tus")
+	cfg.Preview.CachePath = filepath.Join(dir, "preview")
+	config.Config = cfg
+
+	var temps, kept []string
+	for _, path := range []string{cfg.Storage.Local.Path, cfg.Upload.TusPath, cfg.Preview.CachePath} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		temps = append(temps, filepath.Join(path, ".tmp_123"))
+		kept = append(kept, filepath.Join(path, "file"))
+	}
+	for _, file := range append(temps, kept...) {
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeTempFiles(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range temps {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("temp file %s was not removed", file)
+		}
+	}
+	for _, file := range kept {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("file %s: %v", file, err)
+		}
+	}
+}
@@ -1,10 +1,37 @@
 package share
 
-import model "github.com/WindyDante/toolpost/internal/model/share"
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"time"
+
+	model "github.com/WindyDante/toolpost/internal/model/share"
+)
 
 type ShareServiceInterface interface {
-	UploadAnyFile(file model.UploadFile) (model.ShareVo, error)
-	GetShareByCode(code string) (string, error)
-	GetDownloadUrl(key, code string) (string, error)
-	GetShareDetailByCode(code string) (model.ShareDetailVo, error)
+	UploadAnyFile(reader *multipart.Reader) (model.ShareVo, error)
+	GetShareByCode(code, password string) (string, error)
+	GetDownloadFile(key, code, itemID string, inline bool) (model.DownloadFile, error)
+	GetShareDetailByCode(code, password string) (model.ShareDetailVo, error)
+	GetShareItems(code, password string) ([]model.ShareItemVo, error)
+	GetDownloadArchive(key, code, format string) (model.DownloadArchive, error)
+	GetShareTextByCode(code, password string) (string, error)
+	GetPreview(code, password, itemID string) (model.Preview, error)
+}
+
+type TusServiceInterface interface {
+	CreateUpload(upload model.TusUpload) (model.TusUpload, error)
+	GetUpload(id string) (model.TusUpload, error)
+	WriteChunk(id string, offset int64, r io.Reader) (model.TusPatchVo, error)
+	TerminateUpload(id string) error
+	// 删除最后一次上传早于 before 的任务及其分片,返回是否已删除
+	ReapUpload(id string, before time.Time) (bool, error)
+}
+
+type ReaperServiceInterface interface {
+	Start()
+	// 停止后台清理,等待正在进行的清理结束
+	Stop(ctx context.Context) error
+	Reap()
 }
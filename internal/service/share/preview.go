@@ -0,0 +1,141 @@
+package share
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	errModel "github.com/WindyDante/toolpost/internal/model/common"
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	previewUtil "github.com/WindyDante/toolpost/internal/util/preview"
+)
+
+var (
+	ErrPreviewUnsupported = errors.New(errModel.PREVIEW_UNSUPPORTED)
+	ErrPreviewDisabled    = errors.New(errModel.PREVIEW_DISABLED)
+	ErrImageTooLarge      = previewUtil.ErrImageTooLarge
+)
+
+// GetPreview 获取文件预览,图片返回缓存的缩略图,文本返回截取的内容,预览不计入下载次数
+func (s *ShareService) GetPreview(code, password, itemID string) (model.Preview, error) {
+	shareInfo, err := s.getValidShare(code, password)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	item, err := s.shareItem(shareInfo, itemID)
+	if err != nil {
+		return model.Preview{}, err
+	}
+
+	switch {
+	case previewUtil.IsImage(item.MimeType):
+		if !canPreview(shareInfo, item) {
+			return model.Preview{}, ErrPreviewDisabled
+		}
+		return s.thumbnail(item)
+	case previewUtil.IsText(item.MimeType):
+		if !canPreview(shareInfo, item) {
+			return model.Preview{}, ErrPreviewDisabled
+		}
+		return s.textPreview(item)
+	case previewUtil.IsPDF(item.MimeType):
+		// 不生成PDF首页缩略图,见 previewUtil.IsImage
+		return model.Preview{}, fmt.Errorf("%w: %s", ErrPreviewUnsupported, item.MimeType)
+	}
+	return model.Preview{}, ErrPreviewUnsupported
+}
+
+// canPreview 阅后即焚的分享不允许预览,限制下载次数的分享只允许预览图片缩略图
+// 文本预览可能包含全部内容,会绕过下载次数的限制
+func canPreview(shareInfo *model.Share, item *model.ShareItem) bool {
+	switch {
+	case shareInfo.BurnAfterRead:
+		return false
+	case previewUtil.IsImage(item.MimeType):
+		return true
+	case previewUtil.IsText(item.MimeType):
+		return shareInfo.MaxDownloads == 0
+	}
+	return false
+}
+
+// thumbnail 生成或读取缓存的缩略图
+func (s *ShareService) thumbnail(item *model.ShareItem) (model.Preview, error) {
+	previewConfig := config.Config.Preview
+	size := previewConfig.ThumbnailSize
+	etag := ""
+	if item.Hash != "" {
+		etag = `"` + item.Hash + "-" + strconv.Itoa(size) + `"`
+		if data, err := s.previews.Get(item.Hash, size); err == nil {
+			return model.Preview{
+				ContentType: http.DetectContentType(data),
+				Data:        data,
+				ETag:        etag,
+			}, nil
+		}
+	}
+
+	info, err := s.storage.Stat(item.File)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	if info.Size > previewConfig.MaxImageSize {
+		return model.Preview{}, fmt.Errorf("%w: %d", ErrImageTooLarge, info.Size)
+	}
+	reader, err := s.storage.Get(item.File)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	defer reader.Close()
+
+	data, contentType, err := previewUtil.Thumbnail(reader, size, previewConfig.MaxImagePixels)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	// 缓存失败不影响本次预览,下次请求时重新生成
+	if item.Hash != "" {
+		s.previews.Put(item.Hash, size, data)
+	}
+
+	return model.Preview{
+		ContentType: contentType,
+		Data:        data,
+		ETag:        etag,
+	}, nil
+}
+
+// textPreview 读取文本文件开头不超过 maxTextSize 字节的内容
+func (s *ShareService) textPreview(item *model.ShareItem) (model.Preview, error) {
+	limit := config.Config.Preview.MaxTextSize
+	// 多读取一个字节用于判断是否被截断
+	reader, err := s.storage.OpenRange(item.File, 0, int64(limit)+1)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return model.Preview{}, err
+	}
+	data, truncated := previewUtil.TruncateText(data, limit)
+
+	return model.Preview{
+		ContentType: "text/plain; charset=utf-8",
+		Data:        data,
+		ETag:        contentETag(item.Hash),
+		Truncated:   truncated,
+	}, nil
+}
+
+// previewPath 生成预览路径
+func previewPath(code, itemID string) string {
+	path := "/api/share/preview/" + code
+	if itemID != "" {
+		path += "?item=" + itemID
+	}
+	return path
+}
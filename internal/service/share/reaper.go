@@ -0,0 +1,234 @@
+package share
+
+import (
+	"context"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/WindyDante/toolpost/internal/repository/share"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	previewUtil "github.com/WindyDante/toolpost/internal/util/preview"
+	util "github.com/WindyDante/toolpost/internal/util/storage"
+	"go.uber.org/zap"
+)
+
+const REAP_BATCH_SIZE = 500 // 每次从数据库中查询的待清理分享或上传任务数量
+
+type ReaperService struct {
+	shareRepository share.ShareRepositoryInterface
+	tusRepository   share.TusRepositoryInterface
+	tusService      TusServiceInterface
+	storage         util.Storage
+	previews        *previewUtil.Cache
+	stop            chan struct{}
+	done            chan struct{}
+}
+
+func NewReaperService(
+	shareRepository share.ShareRepositoryInterface,
+	tusRepository share.TusRepositoryInterface,
+	tusService TusServiceInterface,
+	storage util.Storage,
+	previews *previewUtil.Cache) ReaperServiceInterface {
+	return &ReaperService{
+		shareRepository: shareRepository,
+		tusRepository:   tusRepository,
+		tusService:      tusService,
+		storage:         storage,
+		previews:        previews,
+	}
+}
+
+// Start 启动后台协程,按配置的间隔定期清理
+// 配置热加载后按新的间隔重新计时,间隔为0时暂停清理
+func (s *ReaperService) Start() {
+	reload := make(chan time.Duration, 1)
+	config.OnReload(func(c *config.ConfigUtil) {
+		// 只保留最新的间隔
+		select {
+		case <-reload:
+		default:
+		}
+		reload <- reaperInterval(c)
+	})
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		interval := reaperInterval(config.Current())
+		ticker := newReaperTicker(interval)
+		defer func() {
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}()
+		for {
+			var tick <-chan time.Time
+			if ticker != nil {
+				tick = ticker.C
+			}
+			select {
+			case <-tick:
+				s.Reap()
+			case next := <-reload:
+				if next == interval {
+					continue
+				}
+				if ticker != nil {
+					ticker.Stop()
+				}
+				interval = next
+				ticker = newReaperTicker(interval)
+				logUtil.Logger.Info("清理间隔已更新", zap.Duration("interval", interval))
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func reaperInterval(c *config.ConfigUtil) time.Duration {
+	return time.Duration(c.Reaper.Interval) * time.Second
+}
+
+// newReaperTicker 间隔为0时返回nil,表示暂停清理
+func newReaperTicker(interval time.Duration) *time.Ticker {
+	if interval <= 0 {
+		return nil
+	}
+	return time.NewTicker(interval)
+}
+
+// Stop 停止后台协程,正在清理时等待本次清理结束,超过ctx的期限时直接返回
+func (s *ReaperService) Stop(ctx context.Context) error {
+	if s.stop == nil {
+		return nil
+	}
+	close(s.stop)
+	s.stop = nil
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reap 清理过期的分享和长时间未继续的断点续传任务
+func (s *ReaperService) Reap() {
+	s.reapShares()
+	s.reapUploads()
+}
+
+// reapShares 将过期或下载次数已用完的分享标记为已过期,并删除不再被引用的文件
+// 分批从数据库中查询需要清理的分享,不会一次加载所有分享
+func (s *ReaperService) reapShares() {
+	grace := time.Duration(config.Current().Reaper.GracePeriod) * time.Second
+	before := time.Now().Add(-grace)
+
+	var scanned, reaped, files, failed int
+	afterID := ""
+	for {
+		shares, err := s.shareRepository.GetReapCandidates(before, afterID, REAP_BATCH_SIZE)
+		if err != nil {
+			logUtil.Logger.Error("获取待清理的分享失败", zap.Error(err))
+			break
+		}
+		scanned += len(shares)
+
+		for i := range shares {
+			deleted, err := reapShare(s.shareRepository, s.storage, s.previews, shares[i].ID)
+			files += deleted
+			if err != nil {
+				logUtil.Logger.Warn("标记过期分享失败", zap.String("id", shares[i].ID), zap.Error(err))
+				failed++
+				continue
+			}
+			reaped++
+		}
+
+		if len(shares) < REAP_BATCH_SIZE {
+			break
+		}
+		afterID = shares[len(shares)-1].ID
+	}
+
+	if reaped > 0 || failed > 0 {
+		logUtil.Logger.Info("过期分享清理完成",
+			zap.Int("scanned", scanned),
+			zap.Int("reaped", reaped),
+			zap.Int("files", files),
+			zap.Int("failed", failed))
+	}
+}
+
+// reapUploads 删除最后一次上传早于 tusExpire 的断点续传任务及其分片
+// 已完成的任务同样删除,之后查询该任务返回不存在
+func (s *ReaperService) reapUploads() {
+	expire := time.Duration(config.Current().Reaper.TusExpire) * time.Second
+	if expire == 0 {
+		return
+	}
+	before := time.Now().Add(-expire)
+
+	var reaped, failed int
+	afterID := ""
+	for {
+		uploads, err := s.tusRepository.GetStaleUploads(before, afterID, REAP_BATCH_SIZE)
+		if err != nil {
+			logUtil.Logger.Error("获取待清理的上传任务失败", zap.Error(err))
+			break
+		}
+
+		for i := range uploads {
+			// 持有任务的锁删除,正在写入的分片完成后才会删除,查询后收到新分片的任务保留
+			deleted, err := s.tusService.ReapUpload(uploads[i].ID, before)
+			if err != nil {
+				logUtil.Logger.Warn("删除上传任务失败", zap.String("id", uploads[i].ID), zap.Error(err))
+				failed++
+				continue
+			}
+			if deleted {
+				reaped++
+			}
+		}
+
+		if len(uploads) < REAP_BATCH_SIZE {
+			break
+		}
+		afterID = uploads[len(uploads)-1].ID
+	}
+
+	if reaped > 0 || failed > 0 {
+		logUtil.Logger.Info("过期上传任务清理完成",
+			zap.Int("reaped", reaped),
+			zap.Int("failed", failed))
+	}
+}
+
+// reapShare 将分享标记为已过期并释放文件引用,删除没有其他分享引用的文件,返回删除的文件数
+// 先更新记录再删除文件,避免新的分享引用到已删除的文件,文件删除失败时只记录日志
+func reapShare(repository share.ShareRepositoryInterface, storage util.Storage, previews *previewUtil.Cache, id string) (int, error) {
+	blobs, err := repository.ReapShare(id)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, blob := range blobs {
+		if err := storage.Delete(blob.File); err != nil {
+			logUtil.Logger.Warn("删除分享文件失败", zap.String("id", id), zap.String("file", blob.File), zap.Error(err))
+			continue
+		}
+		deleted++
+		// 缩略图缓存删除失败不影响清理
+		if blob.Hash == "" {
+			continue
+		}
+		if err := previews.Remove(blob.Hash); err != nil {
+			logUtil.Logger.Warn("删除缩略图缓存失败", zap.String("hash", blob.Hash), zap.Error(err))
+		}
+	}
+	return deleted, nil
+}
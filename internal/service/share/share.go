@@ -1,28 +1,114 @@
 package share
 
 import (
-	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/big"
+	"io"
+	"mime/multipart"
 	"strings"
 	"time"
 
+	"github.com/WindyDante/toolpost/internal/config"
 	errModel "github.com/WindyDante/toolpost/internal/model/common"
 	model "github.com/WindyDante/toolpost/internal/model/share"
 	"github.com/WindyDante/toolpost/internal/repository/share"
+	archiveUtil "github.com/WindyDante/toolpost/internal/util/archive"
+	codeUtil "github.com/WindyDante/toolpost/internal/util/code"
 	cryptoUtil "github.com/WindyDante/toolpost/internal/util/crypto"
+	durationUtil "github.com/WindyDante/toolpost/internal/util/duration"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	previewUtil "github.com/WindyDante/toolpost/internal/util/preview"
 	util "github.com/WindyDante/toolpost/internal/util/storage"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MAX_FORM_FIELD_SIZE         = 1024 * 1024 // 表单普通字段的大小上限(1MB)
+	DEFAULT_DOWNLOAD_URL_EXPIRE = 3600        // 未配置时下载链接的有效期(秒)
+	DEFAULT_MAX_FILES           = 100         // 未配置时一次上传的文件数量上限
+)
+
+var (
+	ErrShareNotFound  = errors.New(errModel.SHARE_NOT_FOUND)
+	ErrShareExpired   = errors.New(errModel.SHARE_EXPIRED)
+	ErrShareHasNoFile = errors.New(errModel.SHARE_HAS_NO_FILE)
+	ErrShareExhausted = errors.New(errModel.SHARE_EXHAUSTED)
+
+	ErrShareItemNotFound = errors.New(errModel.SHARE_ITEM_NOT_FOUND)
+	ErrShareItemRequired = errors.New(errModel.SHARE_ITEM_REQUIRED)
+	ErrTooManyFiles      = errors.New(errModel.TOO_MANY_FILES)
+
+	ErrArchiveFormatUnsupported = archiveUtil.ErrUnsupportedFormat
+
+	ErrInvalidExpire         = durationUtil.ErrInvalidDuration
+	ErrExpireUnitUnsupported = durationUtil.ErrUnsupportedUnit
+
+	ErrPasswordRequired  = errors.New(errModel.PASSWORD_REQUIRED)
+	ErrPasswordIncorrect = errors.New(errModel.PASSWORD_INCORRECT)
+	ErrPasswordTooLong   = errors.New(errModel.PASSWORD_TOO_LONG)
+
+	ErrInvalidCustomCode  = codeUtil.ErrInvalidCustomCode
+	ErrCodeAlreadyExists  = errors.New(errModel.CODE_ALREADY_EXISTS)
+	ErrCodeGenerateFailed = errors.New(errModel.CODE_GENERATE_FAILED)
+
+	ErrKeyNotMatch         = errors.New(errModel.KEY_NOT_MATCH)
+	ErrDownloadLinkExpired = errors.New(errModel.DOWNLOAD_LINK_EXPIRED)
 )
 
 type ShareService struct {
 	shareRepository share.ShareRepositoryInterface
+	storage         util.Storage
+	signer          *cryptoUtil.Signer
+	codes           codeUtil.Generator
+	previews        *previewUtil.Cache
 }
 
-func NewShareService(shareRepository share.ShareRepositoryInterface) ShareServiceInterface {
+func NewShareService(
+	shareRepository share.ShareRepositoryInterface,
+	storage util.Storage,
+	codes codeUtil.Generator,
+	previews *previewUtil.Cache) ShareServiceInterface {
 	return &ShareService{
 		shareRepository: shareRepository,
+		storage:         storage,
+		signer:          newSigner(),
+		codes:           codes,
+		previews:        previews,
+	}
+}
+
+// newSigner 根据配置创建下载链接签名器
+// 未配置密钥时使用随机密钥,服务重启后之前签发的下载链接会失效
+func newSigner() *cryptoUtil.Signer {
+	signer, err := cryptoUtil.NewSigner(config.Config.Security.SigningSecrets)
+	if errors.Is(err, cryptoUtil.ErrNoSigningSecret) {
+		logUtil.Logger.Warn("未配置下载链接签名密钥,使用随机密钥")
+		signer, _ = cryptoUtil.NewSigner([]string{cryptoUtil.RandomSecret()})
+	}
+	return signer
+}
+
+// downloadUrlExpire 返回下载链接的有效期
+func downloadUrlExpire() time.Duration {
+	expire := config.Config.Security.DownloadUrlExpire
+	if expire <= 0 {
+		expire = DEFAULT_DOWNLOAD_URL_EXPIRE
 	}
+	return time.Duration(expire) * time.Second
+}
+
+// verifyDownloadKey 校验下载链接的签名和有效期
+func (s *ShareService) verifyDownloadKey(key string, shareInfo *model.Share) error {
+	err := s.signer.Verify(key, shareInfo.ID, shareInfo.Code, time.Now())
+	switch {
+	case errors.Is(err, cryptoUtil.ErrSignatureExpired):
+		return ErrDownloadLinkExpired
+	case err != nil:
+		return ErrKeyNotMatch
+	}
+	return nil
 }
 
 // extractOriginalFileName 从文件路径中提取原文件名
@@ -67,68 +153,457 @@ func extractOriginalFileName(filePath string) string {
 	return baseName + extension
 }
 
-func (s *ShareService) GetShareDetailByCode(code string) (model.ShareDetailVo, error) {
+func (s *ShareService) GetShareDetailByCode(code, password string) (model.ShareDetailVo, error) {
 	// 获取分享信息
-	shareInfo, err := s.shareRepository.GetShareByCode(code)
+	shareInfo, err := s.getValidShare(code, password)
+	if err != nil {
+		return model.ShareDetailVo{}, err
+	}
+
+	items, err := s.shareItems(shareInfo)
 	if err != nil {
 		return model.ShareDetailVo{}, err
 	}
-	// 从文件路径中提取原文件名
-	fileName := extractOriginalFileName(shareInfo.File)
+
 	shareDetail := model.ShareDetailVo{
-		Text:     shareInfo.Text,
-		FileName: fileName,
+		Type:      model.SHARE_TYPE_TEXT,
+		Text:      shareInfo.Text,
+		Items:     make([]model.ShareItemVo, 0, len(items)),
+		ExpiresAt: shareInfo.ExpiresAt,
+	}
+	for _, item := range items {
+		shareDetail.Items = append(shareDetail.Items, newShareItemVo(shareInfo, item))
+	}
+
+	switch {
+	case shareInfo.File != "":
+		shareDetail.Type = model.SHARE_TYPE_FILE
+		shareDetail.FileName = items[0].FileName
+	case len(items) > 0:
+		shareDetail.Type = model.SHARE_TYPE_FILES
+	default:
+		// 纯文本分享查看详情即视为一次下载
+		if err := s.countDownload(shareInfo); err != nil {
+			return model.ShareDetailVo{}, err
+		}
 	}
 
 	return shareDetail, nil
 }
 
-func (s *ShareService) GetDownloadUrl(key, code string) (string, error) {
-	// 校验key是否正确
-	shareInfo, err := s.shareRepository.GetShareByCode(code)
+// GetShareItems 获取分享中的文件列表,每个文件附带下载链接
+func (s *ShareService) GetShareItems(code, password string) ([]model.ShareItemVo, error) {
+	shareInfo, err := s.getValidShare(code, password)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	// 如果没有找到分享信息
-	if shareInfo == nil {
-		return "", errors.New(errModel.SHARE_NOT_FOUND)
+	items, err := s.shareItems(shareInfo)
+	if err != nil {
+		return nil, err
 	}
-	// 检查是否过期
-	if isExpired(shareInfo) {
-		return "", errors.New(errModel.SHARE_EXPIRED)
+
+	key := s.signer.Sign(shareInfo.ID, shareInfo.Code, time.Now().Add(downloadUrlExpire()))
+	vos := make([]model.ShareItemVo, 0, len(items))
+	for _, item := range items {
+		vo := newShareItemVo(shareInfo, item)
+		vo.DownloadUrl = downloadPath(key, shareInfo.Code, item.ID)
+		vos = append(vos, vo)
 	}
+	return vos, nil
+}
 
-	encryptKey := cryptoUtil.EncryptShareCode(shareInfo.ID, shareInfo.Code)
+// shareItems 获取分享中的所有文件
+// 单文件分享返回由分享信息构造的一项,ID为空;纯文本分享返回空列表
+func (s *ShareService) shareItems(shareInfo *model.Share) ([]model.ShareItem, error) {
+	if shareInfo.File == "" {
+		return s.shareRepository.GetShareItems(shareInfo.ID)
+	}
+
+	info, err := s.storage.Stat(shareInfo.File)
+	if err != nil {
+		return nil, err
+	}
+	item := singleFileItem(shareInfo)
+	item.Size = info.Size
+	return []model.ShareItem{item}, nil
+}
 
-	if encryptKey != key {
-		// 如果key不匹配
-		return "", errors.New(errModel.KEY_NOT_MATCH)
+// singleFileItem 将单文件分享的文件信息构造为一项
+// 旧版本没有保存原文件名和MIME类型,从存储key中提取文件名并根据扩展名判断类型
+func singleFileItem(shareInfo *model.Share) model.ShareItem {
+	item := model.ShareItem{
+		ShareID:  shareInfo.ID,
+		File:     shareInfo.File,
+		FileName: shareInfo.FileName,
+		MimeType: shareInfo.MimeType,
+		Hash:     shareInfo.Hash,
+	}
+	if item.FileName == "" {
+		item.FileName = extractOriginalFileName(shareInfo.File)
+	}
+	if item.MimeType == "" {
+		item.MimeType = util.DetectMimeType(item.FileName, nil)
 	}
+	// 旧版本没有保存SHA-256,但单文件分享以MD5作为ID
+	if item.Hash == "" && isMD5(shareInfo.ID) {
+		item.Hash = shareInfo.ID
+	}
+	return item
+}
 
-	// 获取文件路径和文件名
-	filePath := shareInfo.File
+// shareItem 获取要下载的文件,多文件分享需要指定文件ID
+func (s *ShareService) shareItem(shareInfo *model.Share, itemID string) (*model.ShareItem, error) {
+	if itemID == "" {
+		if shareInfo.File != "" {
+			item := singleFileItem(shareInfo)
+			return &item, nil
+		}
+		items, err := s.shareRepository.GetShareItems(shareInfo.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) > 0 {
+			return nil, ErrShareItemRequired
+		}
+		// 纯文本分享没有可下载的文件
+		return nil, ErrShareHasNoFile
+	}
 
-	return filePath, nil
+	item, err := s.shareRepository.GetShareItem(shareInfo.ID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrShareItemNotFound
+	}
+	return item, nil
 }
 
-func (s *ShareService) GetShareByCode(code string) (string, error) {
-	// 获取分享信息
-	shareInfo, err := s.shareRepository.GetShareByCode(code)
+// GetDownloadArchive 将分享中的所有文件打包下载,打包下载计为一次下载
+func (s *ShareService) GetDownloadArchive(key, code, format string) (model.DownloadArchive, error) {
+	format, err := archiveUtil.NormalizeFormat(format)
+	if err != nil {
+		return model.DownloadArchive{}, err
+	}
+
+	// 与单个文件下载使用相同的签名校验
+	shareInfo, err := s.getDownloadShare(key, code)
+	if err != nil {
+		return model.DownloadArchive{}, err
+	}
+
+	items, err := s.shareItems(shareInfo)
+	if err != nil {
+		return model.DownloadArchive{}, err
+	}
+	if len(items) == 0 {
+		return model.DownloadArchive{}, ErrShareHasNoFile
+	}
+
+	if err := s.countDownload(shareInfo); err != nil {
+		return model.DownloadArchive{}, err
+	}
+
+	entries := make([]archiveUtil.Entry, 0, len(items))
+	for _, item := range items {
+		modTime := item.CreatedAt
+		if modTime.IsZero() {
+			modTime = shareInfo.CreatedAt
+		}
+		entries = append(entries, archiveUtil.Entry{
+			Name:       item.FileName,
+			Size:       item.Size,
+			ModTime:    modTime,
+			Compressed: isCompressedMimeType(item.MimeType),
+			Open: func() (io.ReadCloser, error) {
+				return s.storage.Get(item.File)
+			},
+		})
+	}
+
+	return model.DownloadArchive{
+		FileName:    "share_" + shareInfo.Code + "." + format,
+		ContentType: archiveUtil.ContentType(format),
+		Write: func(w io.Writer) error {
+			err := archiveUtil.Write(w, format, entries)
+			if shareInfo.BurnAfterRead {
+				// 阅后即焚,打包下载结束后删除所有文件
+				s.burn(shareInfo)
+			}
+			return err
+		},
+	}, nil
+}
+
+// isCompressedMimeType 内容已经压缩过的文件类型,打包时再压缩没有收益
+func isCompressedMimeType(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/") && !strings.HasPrefix(mimeType, "image/svg") && !strings.HasPrefix(mimeType, "image/bmp"),
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"):
+		return true
+	}
+	switch mimeType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/vnd.rar", "application/x-xz", "application/zstd":
+		return true
+	}
+	return false
+}
+
+func newShareItemVo(shareInfo *model.Share, item model.ShareItem) model.ShareItemVo {
+	vo := model.ShareItemVo{
+		ID:       item.ID,
+		FileName: item.FileName,
+		Size:     item.Size,
+		MimeType: item.MimeType,
+	}
+	if canPreview(shareInfo, &item) {
+		vo.PreviewUrl = previewPath(shareInfo.Code, item.ID)
+	}
+	return vo
+}
+
+// archivePath 生成打包下载所有文件的路径
+func archivePath(key, code string) string {
+	return fmt.Sprintf("/share/download/archive?key=%s&code=%s", key, code)
+}
+
+// downloadPath 生成下载路径,多文件分享通过item指定文件
+func downloadPath(key, code, itemID string) string {
+	path := fmt.Sprintf("/share/download?key=%s&code=%s", key, code)
+	if itemID != "" {
+		path += "&item=" + itemID
+	}
+	return path
+}
+
+func (s *ShareService) GetShareTextByCode(code, password string) (string, error) {
+	shareInfo, err := s.getValidShare(code, password)
 	if err != nil {
 		return "", err
 	}
+	if err := s.countDownload(shareInfo); err != nil {
+		return "", err
+	}
+	return shareInfo.Text, nil
+}
+
+// countDownload 原子地增加下载次数,下载次数已用完时返回 ErrShareExhausted
+func (s *ShareService) countDownload(shareInfo *model.Share) error {
+	ok, err := s.shareRepository.IncrementDownloads(shareInfo.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrShareExhausted
+	}
+	return nil
+}
+
+// getValidShare 根据访问码获取未过期的分享信息,并校验访问密码
+func (s *ShareService) getValidShare(code, password string) (*model.Share, error) {
+	shareInfo, err := s.getAvailableShare(code)
+	if err != nil {
+		return nil, err
+	}
+	// 检查访问密码
+	if err := checkPassword(shareInfo, password); err != nil {
+		return nil, err
+	}
+	return shareInfo, nil
+}
+
+// getDownloadShare 根据访问码获取未过期的分享信息,并校验下载链接的签名
+// 下载链接只在校验密码后签发,签名有效即表示已通过密码校验,下载时不再需要密码
+func (s *ShareService) getDownloadShare(key, code string) (*model.Share, error) {
+	shareInfo, err := s.getAvailableShare(code)
+	if err != nil {
+		return nil, err
+	}
+	// 校验下载链接的签名,防止伪造或使用过期的链接
+	if err := s.verifyDownloadKey(key, shareInfo); err != nil {
+		return nil, err
+	}
+	return shareInfo, nil
+}
+
+// getAvailableShare 根据访问码获取未过期且下载次数未用完的分享信息
+func (s *ShareService) getAvailableShare(code string) (*model.Share, error) {
+	shareInfo, err := s.shareRepository.GetShareByCode(code)
+	if err != nil {
+		return nil, err
+	}
 	// 如果没有找到分享信息
 	if shareInfo == nil {
-		return "", errors.New(errModel.SHARE_NOT_FOUND)
+		return nil, ErrShareNotFound
 	}
 	// 检查是否过期
 	if isExpired(shareInfo) {
-		return "", errors.New(errModel.SHARE_EXPIRED)
+		return nil, ErrShareExpired
+	}
+	// 检查下载次数是否已用完
+	if shareInfo.Exhausted() {
+		return nil, ErrShareExhausted
+	}
+	return shareInfo, nil
+}
+
+// checkPassword 校验分享的访问密码,未设置密码的分享直接通过
+func checkPassword(shareInfo *model.Share, password string) error {
+	if shareInfo.PasswordHash == "" {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
 	}
+	if err := bcrypt.CompareHashAndPassword([]byte(shareInfo.PasswordHash), []byte(password)); err != nil {
+		return ErrPasswordIncorrect
+	}
+	return nil
+}
+
+// setPassword 计算访问密码的哈希并保存到分享信息中
+func setPassword(shareInfo *model.Share, password string) error {
+	if password == "" {
+		return nil
+	}
+	// bcrypt 只使用前72个字节
+	if len(password) > 72 {
+		return ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	shareInfo.PasswordHash = string(hash)
+	return nil
+}
+
+func (s *ShareService) GetDownloadFile(key, code, itemID string, inline bool) (model.DownloadFile, error) {
+	// 校验key是否正确
+	shareInfo, err := s.getDownloadShare(key, code)
+	if err != nil {
+		return model.DownloadFile{}, err
+	}
+
+	item, err := s.shareItem(shareInfo, itemID)
+	if err != nil {
+		return model.DownloadFile{}, err
+	}
+
+	// 由调用方决定是否计入下载,断点续传的后续分段和304响应不计入
+	counted := false
+	count := func() error {
+		if err := s.countDownload(shareInfo); err != nil {
+			return err
+		}
+		counted = true
+		return nil
+	}
+
+	fileName := item.FileName
+	// 只有浏览器可以安全展示的类型才允许在线预览
+	disposition := util.DISPOSITION_ATTACHMENT
+	if inline && util.IsPreviewable(item.MimeType) {
+		disposition = util.DISPOSITION_INLINE
+	}
+
+	// 存储支持预签名时直接返回预签名链接,文件不经过服务端
+	// 阅后即焚的文件需要在下载完成后删除,必须经过服务端
+	if presigner, ok := s.storage.(util.Presigner); ok && !shareInfo.BurnAfterRead {
+		redirect, err := presigner.PresignGet(item.File, util.ContentDisposition(disposition, fileName), item.MimeType)
+		if err != nil {
+			return model.DownloadFile{}, err
+		}
+		if redirect != "" {
+			return model.DownloadFile{
+				FileName: fileName,
+				Redirect: redirect,
+				Count:    count,
+			}, nil
+		}
+	}
+
+	// 从存储中获取文件
+	info, err := s.storage.Stat(item.File)
+	if err != nil {
+		return model.DownloadFile{}, err
+	}
+	reader := util.NewReadSeeker(s.storage, item.File, info.Size)
+	if shareInfo.BurnAfterRead {
+		// 阅后即焚,计入下载的请求结束后删除文件
+		reader = &burnReadCloser{
+			ReadSeekCloser: reader,
+			burn: func() {
+				if counted {
+					s.burn(shareInfo)
+				}
+			},
+		}
+	}
+
+	return model.DownloadFile{
+		FileName:      fileName,
+		Size:          info.Size,
+		ModTime:       info.ModTime,
+		MimeType:      item.MimeType,
+		Disposition:   disposition,
+		ETag:          contentETag(item.Hash),
+		Reader:        reader,
+		BurnAfterRead: shareInfo.BurnAfterRead,
+		Count:         count,
+	}, nil
+}
 
-	key := cryptoUtil.EncryptShareCode(shareInfo.ID, shareInfo.Code)
+// burn 阅后即焚的分享下载后立即清理,相同内容的文件仍被其他分享引用时保留
+func (s *ShareService) burn(shareInfo *model.Share) {
+	if _, err := reapShare(s.shareRepository, s.storage, s.previews, shareInfo.ID); err != nil {
+		logUtil.Logger.Warn("阅后即焚清理分享失败", zap.String("id", shareInfo.ID), zap.Error(err))
+	}
+}
+
+// contentETag 使用文件内容的哈希作为强ETag
+func contentETag(hash string) string {
+	if hash == "" {
+		return ""
+	}
+	return `"` + hash + `"`
+}
+
+// isMD5 是否为十六进制的MD5值
+func isMD5(value string) bool {
+	if len(value) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+func (s *ShareService) GetShareByCode(code, password string) (string, error) {
+	// 获取分享信息
+	shareInfo, err := s.getValidShare(code, password)
+	if err != nil {
+		return "", err
+	}
 
-	downloadURL := fmt.Sprintf("/share/download?key=%s&code=%s", key, code)
+	var downloadURL string
+	key := s.signer.Sign(shareInfo.ID, shareInfo.Code, time.Now().Add(downloadUrlExpire()))
+	if shareInfo.File != "" {
+		downloadURL = downloadPath(key, code, "")
+	} else {
+		items, err := s.shareRepository.GetShareItems(shareInfo.ID)
+		if err != nil {
+			return "", err
+		}
+		if len(items) > 0 {
+			// 多文件分享返回打包下载所有文件的地址
+			downloadURL = archivePath(key, code)
+		} else {
+			// 纯文本分享返回原始文本地址
+			downloadURL = fmt.Sprintf("/api/share/raw/%s", code)
+		}
+	}
 
 	// 更新访问次数
 	if err := s.shareRepository.UpdateByStatus(shareInfo.ID); err != nil {
@@ -140,99 +615,287 @@ func (s *ShareService) GetShareByCode(code string) (string, error) {
 
 // 检查是否过期的辅助方法
 func isExpired(shareInfo *model.Share) bool {
+	// 如果 ExpiresAt 为空，表示永不过期
+	return shareInfo.ExpiresAt != nil && time.Now().After(*shareInfo.ExpiresAt)
+}
 
-	// 如果 Expire 为 0，表示永不过期
-	if shareInfo.Expire == 0 {
-		return false
+// calculateExpiresAt 根据上传表单计算过期时间,未设置有效时长时返回nil
+func calculateExpiresAt(form model.UploadFile, now time.Time) (*time.Time, error) {
+	var duration time.Duration
+	switch {
+	case form.Expire != "":
+		var err error
+		if duration, err = durationUtil.ParseDuration(form.Expire); err != nil {
+			return nil, err
+		}
+	case form.ExpireTime != 0:
+		// 兼容旧版的 expireTime + expireUnit
+		unit, ok := model.EXPIRE_UNITS[form.ExpireUnit]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrExpireUnitUnsupported, form.ExpireUnit)
+		}
+		if form.ExpireTime < 0 {
+			return nil, fmt.Errorf("%w: %d", ErrInvalidExpire, form.ExpireTime)
+		}
+		duration = time.Duration(form.ExpireTime) * unit
 	}
 
-	var duration time.Duration
+	if duration == 0 {
+		return nil, nil
+	}
+	expiresAt := now.Add(duration)
+	return &expiresAt, nil
+}
 
-	// 根据过期单位转换为 time.Duration
-	switch shareInfo.ExpireUnit {
-	case 1: // 分钟
-		duration = time.Duration(shareInfo.Expire) * time.Minute
-	case 2: // 小时
-		duration = time.Duration(shareInfo.Expire) * time.Hour
-	case 3: // 天
-		duration = time.Duration(shareInfo.Expire) * 24 * time.Hour
-	default:
-		// 默认按分钟处理
-		duration = time.Duration(shareInfo.Expire) * time.Minute
+func (s *ShareService) UploadAnyFile(reader *multipart.Reader) (model.ShareVo, error) {
+	var form model.UploadFile
+	var files []util.StoredFile
+
+	// 逐个读取表单字段,文件字段直接写入存储,不在内存或临时文件中缓存整个请求
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.removeStoredFiles(files)
+			return model.ShareVo{}, errors.New(errModel.INVALID_REQUEST_FORM)
+		}
+
+		if part.FormName() == "file" {
+			// 多个文件字段时作为多文件分享
+			if len(files) >= maxFiles() {
+				s.removeStoredFiles(files)
+				return model.ShareVo{}, ErrTooManyFiles
+			}
+			// 写入存储的同时计算哈希值,超过大小限制时中断
+			file, err := util.UploadStream(s.storage, part.FileName(), part, config.Current().Upload.MaxSize)
+			if err != nil {
+				s.removeStoredFiles(files)
+				return model.ShareVo{}, err
+			}
+			files = append(files, file)
+			continue
+		}
+
+		if err := bindUploadField(&form, part); err != nil {
+			s.removeStoredFiles(files)
+			return model.ShareVo{}, err
+		}
 	}
 
-	// 计算过期时间
-	expireTime := shareInfo.CreatedAt.Add(8*time.Hour + duration)
+	// 校验并计算过期时间
+	expiresAt, err := calculateExpiresAt(form, time.Now())
+	if err != nil {
+		s.removeStoredFiles(files)
+		return model.ShareVo{}, err
+	}
 
-	// 检查是否已过期
-	return time.Now().Add(8 * time.Hour).After(expireTime)
+	// 自定义访问码在保存时校验,失败时删除已写入的文件
+	if len(files) == 0 {
+		// 没有文件时作为纯文本分享
+		return s.saveTextShare(form, expiresAt)
+	}
+	if len(files) == 1 {
+		return s.saveFileShare(form, &files[0], expiresAt)
+	}
+	return s.saveMultiFileShare(form, files, expiresAt)
 }
 
-func (s *ShareService) UploadAnyFile(file model.UploadFile) (model.ShareVo, error) {
-	// 获取本地md5值与数据库中对应的md5值进行对比
-	// 如果存在相同的md5值，则直接返回对应的分享信息
-	md5Val, err := util.CalculateFileMD5(file.File)
+// saveFileShare 保存已写入存储的文件分享,失败时删除文件
+// 每次上传都创建新的分享,相同内容的文件只保留一份
+func (s *ShareService) saveFileShare(form model.UploadFile, stored *util.StoredFile, expiresAt *time.Time) (model.ShareVo, error) {
+	// 设置Share结构体的信息
+	storageShare := form.NewShare(cryptoUtil.GenerateUUID(), stored.Key, expiresAt)
+	storageShare.Hash = stored.SHA256
+	storageShare.FileName = stored.FileName
+	storageShare.MimeType = stored.MimeType
+	if err := setPassword(&storageShare, form.Password); err != nil {
+		s.removeStoredFile(stored)
+		return model.ShareVo{}, err
+	}
 
-	if err != nil {
+	// 保存信息
+	if err := saveShareWithCode(s.shareRepository, s.codes, &storageShare, form.Code); err != nil {
+		s.removeStoredFile(stored)
 		return model.ShareVo{}, err
 	}
+	s.removeDuplicateFile(stored, storageShare.File)
 
-	// 检查是否已存在相同的文件
-	shareInfo, err := s.shareRepository.GetShareByMD5(md5Val)
-	if err != nil {
+	return model.ShareVo{
+		FileUrl:   storageShare.File,
+		Code:      storageShare.Code,
+		ExpiresAt: storageShare.ExpiresAt,
+	}, nil
+}
+
+// saveMultiFileShare 保存多文件分享,每个文件作为一项,失败时删除所有文件
+func (s *ShareService) saveMultiFileShare(form model.UploadFile, files []util.StoredFile, expiresAt *time.Time) (model.ShareVo, error) {
+	multiShare := form.NewShare(cryptoUtil.GenerateUUID(), "", expiresAt)
+	for i, file := range files {
+		multiShare.Items = append(multiShare.Items, model.ShareItem{
+			ID:       cryptoUtil.GenerateUUID(),
+			File:     file.Key,
+			FileName: file.FileName,
+			Size:     file.Size,
+			MimeType: file.MimeType,
+			Hash:     file.SHA256,
+			Sort:     i,
+		})
+	}
+	if err := setPassword(&multiShare, form.Password); err != nil {
+		s.removeStoredFiles(files)
+		return model.ShareVo{}, err
+	}
+	if err := saveShareWithCode(s.shareRepository, s.codes, &multiShare, form.Code); err != nil {
+		s.removeStoredFiles(files)
 		return model.ShareVo{}, err
 	}
+	for i := range files {
+		s.removeDuplicateFile(&files[i], multiShare.Items[i].File)
+	}
 
-	if shareInfo != nil {
-		// 如果文件已存在，直接返回已存在的分享信息
-		return model.ShareVo{
-			FileUrl: shareInfo.File,
-			Code:    shareInfo.Code,
-		}, nil
+	return model.ShareVo{
+		Code:      multiShare.Code,
+		ExpiresAt: multiShare.ExpiresAt,
+	}, nil
+}
+
+// maxFiles 一次上传的文件数量上限
+func maxFiles() int {
+	limit := config.Current().Upload.MaxFiles
+	if limit <= 0 {
+		return DEFAULT_MAX_FILES
 	}
+	return limit
+}
 
-	var storageShare model.Share
-	if file.File.Size > int64(1024*1024*500) {
-		// 限制文件大小为500MB,不写为常量,仅在此处使用
-		return model.ShareVo{}, errors.New(errModel.FILE_MAX_SIZE_EXCEEDED)
+// saveTextShare 保存不带文件的纯文本分享
+func (s *ShareService) saveTextShare(form model.UploadFile, expiresAt *time.Time) (model.ShareVo, error) {
+	if form.Text == "" {
+		return model.ShareVo{}, errors.New(errModel.NO_FILE_UPLOAD)
 	}
 
-	// 调用上传的本地工具类,上传后返回url自动拼接
-	url, err := util.UploadFile(file.File)
-	if err != nil {
+	// 纯文本分享没有文件内容可供去重,使用随机ID
+	textShare := form.NewShare(cryptoUtil.GenerateUUID(), "", expiresAt)
+	if err := setPassword(&textShare, form.Password); err != nil {
+		return model.ShareVo{}, err
+	}
+	if err := saveShareWithCode(s.shareRepository, s.codes, &textShare, form.Code); err != nil {
 		return model.ShareVo{}, err
 	}
 
-	// 定义随机数的最大值 (1,000,000)
-	max := big.NewInt(1000000)
+	return model.ShareVo{
+		Code:      textShare.Code,
+		ExpiresAt: textShare.ExpiresAt,
+	}, nil
+}
 
-	// 生成一个 [0, max) 区间的密码学安全的随机整数
-	n, _ := rand.Int(rand.Reader, max)
+// removeStoredFile 上传失败时删除已写入存储的文件
+func (s *ShareService) removeStoredFile(stored *util.StoredFile) {
+	if stored != nil {
+		s.storage.Delete(stored.Key)
+	}
+}
 
-	// 若code不为空，是有自定义code
-	// 否则使用 fmt.Sprintf 格式化为6位数字，不足6位的前面补0
-	code := file.Code
-	if file.Code == "" {
-		code = fmt.Sprintf("%06d", n.Int64())
+// removeStoredFiles 上传失败时删除所有已写入存储的文件
+func (s *ShareService) removeStoredFiles(files []util.StoredFile) {
+	for i := range files {
+		s.removeStoredFile(&files[i])
 	}
+}
 
-	// 设置Share结构体的信息
-	storageShare = model.Share{
-		ID:         md5Val,
-		File:       url,
-		Expire:     file.ExpireTime,
-		ExpireUnit: file.ExpireUnit,
-		Text:       file.Text,
-		Code:       code, // 生成6位随机数作为访问码
+// removeDuplicateFile 保存时发现相同内容的文件已存在,删除刚写入的文件
+func (s *ShareService) removeDuplicateFile(stored *util.StoredFile, file string) {
+	if stored.Key != file {
+		s.removeStoredFile(stored)
 	}
+}
 
-	// 保存信息
-	if err := s.shareRepository.SaveShare(&storageShare); err != nil {
-		return model.ShareVo{}, err
+// bindUploadField 将表单中的普通字段绑定到 UploadFile
+func bindUploadField(form *model.UploadFile, part *multipart.Part) error {
+	// 普通字段限制读取大小,防止超大的表单字段占用内存
+	data, err := io.ReadAll(io.LimitReader(part, MAX_FORM_FIELD_SIZE+1))
+	if err != nil || len(data) > MAX_FORM_FIELD_SIZE {
+		return errors.New(errModel.INVALID_REQUEST_FORM)
+	}
+	if err := form.SetField(part.FormName(), string(data)); err != nil {
+		return errors.New(errModel.INVALID_REQUEST_FORM)
 	}
+	return nil
+}
 
-	return model.ShareVo{
-		FileUrl: url,
-		Code:    storageShare.Code,
-	}, nil
+// burnReadCloser 关闭时执行删除操作的ReadSeekCloser,用于阅后即焚
+type burnReadCloser struct {
+	io.ReadSeekCloser
+	burn func()
+}
+
+func (b *burnReadCloser) Close() error {
+	err := b.ReadSeekCloser.Close()
+	b.burn()
+	return err
+}
+
+// checkCustomCode 校验自定义访问码的格式,并检查是否已被使用
+func checkCustomCode(repository share.ShareRepositoryInterface, codes codeUtil.Generator, custom string) error {
+	if custom == "" {
+		return nil
+	}
+	if err := codes.Validate(custom); err != nil {
+		return err
+	}
+	exists, err := repository.CodeExists(custom)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrCodeAlreadyExists
+	}
+	return nil
+}
+
+// saveShareWithCode 设置访问码并保存分享
+// 若custom不为空则使用自定义访问码,否则生成随机访问码,与已有访问码冲突时重新生成
+func saveShareWithCode(repository share.ShareRepositoryInterface, codes codeUtil.Generator, shareInfo *model.Share, custom string) error {
+	if custom != "" {
+		if err := checkCustomCode(repository, codes, custom); err != nil {
+			return err
+		}
+		shareInfo.Code = custom
+		return translateCodeConflict(repository, repository.SaveShare(shareInfo), custom)
+	}
+
+	for i := 0; i < codes.Retries(); i++ {
+		code, err := codes.Generate()
+		if err != nil {
+			return err
+		}
+		exists, err := repository.CodeExists(code)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		shareInfo.Code = code
+		err = translateCodeConflict(repository, repository.SaveShare(shareInfo), code)
+		// 检查后保存前访问码被并发的请求占用时重新生成
+		if !errors.Is(err, ErrCodeAlreadyExists) {
+			return err
+		}
+	}
+	return ErrCodeGenerateFailed
+}
+
+// translateCodeConflict 保存时发生唯一约束冲突且访问码已被占用时,返回访问码已存在
+func translateCodeConflict(repository share.ShareRepositoryInterface, err error, code string) error {
+	if !errors.Is(err, share.ErrDuplicatedKey) {
+		return err
+	}
+	if exists, existsErr := repository.CodeExists(code); existsErr == nil && exists {
+		return ErrCodeAlreadyExists
+	}
+	return err
 }
@@ -0,0 +1,107 @@
+package share
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/WindyDante/toolpost/internal/database"
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	"github.com/WindyDante/toolpost/internal/repository/share"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(config.DatabaseConfig{Type: database.DATABASE_TYPE_SQLITE, Path: database.SQLITE_MEMORY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := database.MigrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// sequenceGenerator 按顺序返回预设的访问码,用于模拟访问码冲突
+type sequenceGenerator struct {
+	codes   []string
+	retries int
+	calls   int
+}
+
+func (g *sequenceGenerator) Generate() (string, error) {
+	code := g.codes[g.calls%len(g.codes)]
+	g.calls++
+	return code, nil
+}
+
+func (g *sequenceGenerator) Validate(custom string) error {
+	return nil
+}
+
+func (g *sequenceGenerator) Retries() int {
+	return g.retries
+}
+
+func TestSaveShareWithCodeRetriesOnCollision(t *testing.T) {
+	tests := []struct {
+		name      string
+		codes     []string
+		retries   int
+		want      string
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "no collision", codes: []string{"222222"}, retries: 3, want: "222222", wantCalls: 1},
+		{name: "collision then free", codes: []string{"111111", "111111", "222222"}, retries: 3, want: "222222", wantCalls: 3},
+		{name: "all collide", codes: []string{"111111"}, retries: 3, wantErr: ErrCodeGenerateFailed, wantCalls: 3},
+		{name: "free code after last retry", codes: []string{"111111", "111111", "222222"}, retries: 2, wantErr: ErrCodeGenerateFailed, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := share.NewShareRepository(openTestDB(t))
+			if err := repository.SaveShare(&model.Share{ID: "taken", Code: "111111"}); err != nil {
+				t.Fatal(err)
+			}
+			codes := &sequenceGenerator{codes: tt.codes, retries: tt.retries}
+
+			shareInfo := &model.Share{ID: "new"}
+			err := saveShareWithCode(repository, codes, shareInfo, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("saveShareWithCode() = %v, want %v", err, tt.wantErr)
+			}
+			if codes.calls != tt.wantCalls {
+				t.Errorf("Generate called %d times, want %d", codes.calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil && shareInfo.Code != tt.want {
+				t.Errorf("code = %q, want %q", shareInfo.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveShareWithCustomCode(t *testing.T) {
+	repository := share.NewShareRepository(openTestDB(t))
+	if err := repository.SaveShare(&model.Share{ID: "taken", Code: "mine"}); err != nil {
+		t.Fatal(err)
+	}
+	codes := &sequenceGenerator{codes: []string{"222222"}, retries: 3}
+
+	// 自定义访问码已被使用时不会改用随机访问码
+	if err := saveShareWithCode(repository, codes, &model.Share{ID: "a"}, "mine"); !errors.Is(err, ErrCodeAlreadyExists) {
+		t.Errorf("taken custom code = %v, want %v", err, ErrCodeAlreadyExists)
+	}
+	shareInfo := &model.Share{ID: "b"}
+	if err := saveShareWithCode(repository, codes, shareInfo, "yours"); err != nil {
+		t.Fatal(err)
+	}
+	if shareInfo.Code != "yours" || codes.calls != 0 {
+		t.Errorf("code = %q after %d generated codes, want %q without generating", shareInfo.Code, codes.calls, "yours")
+	}
+}
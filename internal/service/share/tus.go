@@ -0,0 +1,381 @@
+package share
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	errModel "github.com/WindyDante/toolpost/internal/model/common"
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	"github.com/WindyDante/toolpost/internal/repository/share"
+	codeUtil "github.com/WindyDante/toolpost/internal/util/code"
+	cryptoUtil "github.com/WindyDante/toolpost/internal/util/crypto"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	util "github.com/WindyDante/toolpost/internal/util/storage"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrTusUploadNotFound   = errors.New(errModel.TUS_UPLOAD_NOT_FOUND)
+	ErrTusOffsetMismatch   = errors.New(errModel.TUS_OFFSET_MISMATCH)
+	ErrTusInvalidLength    = errors.New(errModel.TUS_INVALID_LENGTH)
+	ErrFileMaxSizeExceeded = util.ErrFileMaxSizeExceeded
+)
+
+type TusService struct {
+	tusRepository   share.TusRepositoryInterface
+	shareRepository share.ShareRepositoryInterface
+	storage         util.Storage
+	chunks          util.Storage // 未完成的分片,开启加密时与分享文件一样加密保存
+	codes           codeUtil.Generator
+}
+
+// uploadLocks 每个上传任务一把锁,防止同一任务的分片并发写入,以及写入时被清理
+// 接口和后台清理使用不同的 TusService 实例,锁需要在实例之间共享
+var uploadLocks = &lockTable{locks: make(map[string]*lockEntry)}
+
+// lockTable 按上传任务ID加锁,没有协程持有或等待时删除对应的锁
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[string]*lockEntry
+}
+
+type lockEntry struct {
+	sync.Mutex
+	refs int // 持有和等待该锁的协程数
+}
+
+// lock 获取id对应的锁,返回解锁函数
+func (t *lockTable) lock(id string) func() {
+	t.mu.Lock()
+	entry, ok := t.locks[id]
+	if !ok {
+		entry = &lockEntry{}
+		t.locks[id] = entry
+	}
+	entry.refs++
+	t.mu.Unlock()
+
+	entry.Lock()
+	return func() {
+		entry.Unlock()
+		t.mu.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(t.locks, id)
+		}
+		t.mu.Unlock()
+	}
+}
+
+func NewTusService(
+	tusRepository share.TusRepositoryInterface,
+	shareRepository share.ShareRepositoryInterface,
+	storage util.Storage,
+	codes codeUtil.Generator) (TusServiceInterface, error) {
+	chunks, err := util.NewLocalScratch(config.Config.Upload.TusPath)
+	if err != nil {
+		return nil, err
+	}
+	return &TusService{
+		tusRepository:   tusRepository,
+		shareRepository: shareRepository,
+		storage:         storage,
+		chunks:          chunks,
+		codes:           codes,
+	}, nil
+}
+
+// chunkKey 每次PATCH请求接收的数据单独保存,以上传任务ID和起始偏移量命名,按名称排序即为写入顺序
+func chunkKey(id string, offset int64) string {
+	return fmt.Sprintf("%s_%020d", id, offset)
+}
+
+// chunkFiles 上传任务已接收的分片文件,包括加密时的数据密钥文件
+// 旧版本将所有分片追加写入以任务ID命名的单个文件,排序后位于最前面
+func chunkFiles(id string) ([]string, error) {
+	return filepath.Glob(filepath.Join(config.Config.Upload.TusPath, id+"*"))
+}
+
+// removeChunks 删除上传任务的所有分片
+func removeChunks(id string) error {
+	files, err := chunkFiles(id)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// openChunks 按写入顺序读取上传任务的所有分片
+func (s *TusService) openChunks(id string) (io.ReadCloser, error) {
+	files, err := chunkFiles(id)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, file := range files {
+		if !strings.HasSuffix(file, util.ENVELOPE_SUFFIX) {
+			keys = append(keys, filepath.Base(file))
+		}
+	}
+	sort.Strings(keys)
+	return &chunksReader{storage: s.chunks, keys: keys}, nil
+}
+
+func (s *TusService) CreateUpload(upload model.TusUpload) (model.TusUpload, error) {
+	if upload.Length < 0 {
+		return model.TusUpload{}, ErrTusInvalidLength
+	}
+	if upload.Length > config.Current().Upload.MaxSize {
+		return model.TusUpload{}, ErrFileMaxSizeExceeded
+	}
+	// 创建时校验过期时间,避免上传完成后才发现参数错误
+	if _, err := calculateExpiresAt(upload.Form, time.Now()); err != nil {
+		return model.TusUpload{}, err
+	}
+	// 密码在创建时计算哈希,上传任务中不保存明文
+	var passwordShare model.Share
+	if err := setPassword(&passwordShare, upload.Form.Password); err != nil {
+		return model.TusUpload{}, err
+	}
+	upload.PasswordHash = passwordShare.PasswordHash
+	// 自定义访问码在创建时校验,上传完成时仍可能被占用,保存时会再次检查
+	if err := checkCustomCode(s.shareRepository, s.codes, upload.Form.Code); err != nil {
+		return model.TusUpload{}, err
+	}
+
+	// 分片在接收时写入,创建时只保存任务信息
+	upload.ID = cryptoUtil.GenerateUUID()
+	upload.Offset = 0
+	if err := s.tusRepository.SaveUpload(&upload); err != nil {
+		return model.TusUpload{}, err
+	}
+
+	// 空文件无需上传分片,直接完成
+	if upload.Length == 0 {
+		shareCode, err := s.finishUpload(&upload)
+		if err != nil {
+			return model.TusUpload{}, err
+		}
+		upload.ShareCode = shareCode
+	}
+
+	return upload, nil
+}
+
+func (s *TusService) GetUpload(id string) (model.TusUpload, error) {
+	upload, err := s.tusRepository.GetUploadByID(id)
+	if err != nil {
+		return model.TusUpload{}, err
+	}
+	if upload == nil {
+		return model.TusUpload{}, ErrTusUploadNotFound
+	}
+	return *upload, nil
+}
+
+func (s *TusService) WriteChunk(id string, offset int64, r io.Reader) (model.TusPatchVo, error) {
+	unlock := uploadLocks.lock(id)
+	defer unlock()
+
+	upload, err := s.GetUpload(id)
+	if err != nil {
+		return model.TusPatchVo{}, err
+	}
+	if offset != upload.Offset {
+		return model.TusPatchVo{}, ErrTusOffsetMismatch
+	}
+	// 已完成的任务直接返回结果
+	if upload.ShareCode != "" {
+		return model.TusPatchVo{
+			Offset:    upload.Offset,
+			ShareCode: upload.ShareCode,
+		}, nil
+	}
+
+	// 写入新的分片,最多写到文件总大小
+	// 连接中断时保存已接收的部分,客户端可从该偏移量继续上传
+	key := chunkKey(id, upload.Offset)
+	body := &partialReader{r: io.LimitReader(r, upload.Length-upload.Offset)}
+	n, err := s.chunks.Put(key, body)
+	if err != nil {
+		s.chunks.Delete(key)
+		return model.TusPatchVo{Offset: upload.Offset}, err
+	}
+	if n == 0 {
+		s.chunks.Delete(key)
+	}
+	copyErr := body.err
+
+	upload.Offset += n
+	if err := s.tusRepository.UpdateOffset(id, upload.Offset); err != nil {
+		return model.TusPatchVo{}, err
+	}
+	if copyErr != nil {
+		return model.TusPatchVo{Offset: upload.Offset}, copyErr
+	}
+
+	vo := model.TusPatchVo{Offset: upload.Offset}
+	if upload.Offset == upload.Length {
+		// 最后一个分片到达,生成分享
+		vo.ShareCode, err = s.finishUpload(&upload)
+		if err != nil {
+			return model.TusPatchVo{}, err
+		}
+	}
+	return vo, nil
+}
+
+func (s *TusService) TerminateUpload(id string) error {
+	unlock := uploadLocks.lock(id)
+	defer unlock()
+
+	if _, err := s.GetUpload(id); err != nil {
+		return err
+	}
+	if err := removeChunks(id); err != nil {
+		return err
+	}
+	return s.tusRepository.DeleteUpload(id)
+}
+
+// ReapUpload 删除最后一次上传早于 before 的任务及其分片,返回是否已删除
+// 与写入分片使用同一把锁,查询后又收到分片的任务不会被删除
+func (s *TusService) ReapUpload(id string, before time.Time) (bool, error) {
+	unlock := uploadLocks.lock(id)
+	defer unlock()
+
+	upload, err := s.GetUpload(id)
+	if errors.Is(err, ErrTusUploadNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// 旧版本的任务没有更新时间,按创建时间判断
+	lastActive := upload.UpdatedAt
+	if lastActive.IsZero() {
+		lastActive = upload.CreatedAt
+	}
+	if !lastActive.Before(before) {
+		return false, nil
+	}
+
+	// 先删除任务记录,删除分片失败时任务也不会再被继续
+	if err := s.tusRepository.DeleteUpload(id); err != nil {
+		return false, err
+	}
+	if err := removeChunks(id); err != nil {
+		logUtil.Logger.Warn("删除上传分片失败", zap.String("id", id), zap.Error(err))
+	}
+	return true, nil
+}
+
+// finishUpload 将接收完成的文件写入存储并生成分享,返回访问码
+func (s *TusService) finishUpload(upload *model.TusUpload) (string, error) {
+	// 写入存储的同时计算哈希值
+	file, err := s.openChunks(upload.ID)
+	if err != nil {
+		return "", err
+	}
+	// 创建时已校验过大小,上传过程中修改了大小上限也不影响已接受的上传
+	stored, err := util.UploadStream(s.storage, upload.FileName, file, upload.Length)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+
+	// 过期时间从上传完成时开始计算
+	expiresAt, err := calculateExpiresAt(upload.Form, time.Now())
+	if err != nil {
+		s.storage.Delete(stored.Key)
+		return "", err
+	}
+	shareInfo := upload.Form.NewShare(cryptoUtil.GenerateUUID(), stored.Key, expiresAt)
+	shareInfo.Hash = stored.SHA256
+	shareInfo.FileName = stored.FileName
+	shareInfo.MimeType = stored.MimeType
+	shareInfo.PasswordHash = upload.PasswordHash
+	if err := saveShareWithCode(s.shareRepository, s.codes, &shareInfo, upload.Form.Code); err != nil {
+		s.storage.Delete(stored.Key)
+		return "", err
+	}
+	// 相同内容的文件已存在时删除刚写入的文件
+	if shareInfo.File != stored.Key {
+		s.storage.Delete(stored.Key)
+	}
+
+	if err := s.tusRepository.UpdateShareCode(upload.ID, shareInfo.Code); err != nil {
+		return "", err
+	}
+	upload.ShareCode = shareInfo.Code
+	removeChunks(upload.ID)
+
+	return shareInfo.Code, nil
+}
+
+// partialReader 读取出错时记录错误并当作读取结束,使已接收的数据仍能完整写入
+type partialReader struct {
+	r   io.Reader
+	err error
+}
+
+func (p *partialReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF {
+		p.err = err
+		err = io.EOF
+	}
+	return n, err
+}
+
+// chunksReader 依次读取上传任务的分片,每次只打开一个分片
+type chunksReader struct {
+	storage util.Storage
+	keys    []string
+	current io.ReadCloser
+}
+
+func (c *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			r, err := c.storage.Get(c.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current, c.keys = r, c.keys[1:]
+		}
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunksReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.Close()
+}
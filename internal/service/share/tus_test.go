@@ -0,0 +1,143 @@
+package share
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	model "github.com/WindyDante/toolpost/internal/model/share"
+	"github.com/WindyDante/toolpost/internal/repository/share"
+	codeUtil "github.com/WindyDante/toolpost/internal/util/code"
+	logUtil "github.com/WindyDante/toolpost/internal/util/log"
+	util "github.com/WindyDante/toolpost/internal/util/storage"
+)
+
+func newTestTusService(t *testing.T) *TusService {
+	t.Helper()
+	logUtil.InitLogger()
+
+	dir := t.TempDir()
+	cfg, err := config.Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.Local.Path = filepath.Join(dir, "share")
+	cfg.Upload.TusPath = filepath.Join(dir, "tus")
+	config.Config = cfg
+
+	db := openTestDB(t)
+	storage, err := util.NewStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := codeUtil.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tus, err := NewTusService(share.NewTusRepository(db), share.NewShareRepository(db), storage, codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tus.(*TusService)
+}
+
+func TestLockTable(t *testing.T) {
+	table := &lockTable{locks: make(map[string]*lockEntry)}
+
+	var wg sync.WaitGroup
+	counters := map[string]*int{"a": new(int), "b": new(int)}
+	for i := 0; i < 50; i++ {
+		for id, count := range counters {
+			wg.Add(1)
+			go func(id string, count *int) {
+				defer wg.Done()
+				unlock := table.lock(id)
+				defer unlock()
+				*count++
+			}(id, count)
+		}
+	}
+	wg.Wait()
+
+	for id, count := range counters {
+		if *count != 50 {
+			t.Errorf("counter %s = %d, want 50", id, *count)
+		}
+	}
+	// 没有协程持有或等待时不保留锁
+	if len(table.locks) != 0 {
+		t.Errorf("%d locks left after all unlocked", len(table.locks))
+	}
+}
+
+func TestReapUploadWaitsForWrite(t *testing.T) {
+	s := newTestTusService(t)
+	upload, err := s.CreateUpload(model.TusUpload{Length: 10, FileName: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteChunk(upload.ID, 0, bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟正在写入分片的请求
+	unlock := uploadLocks.lock(upload.ID)
+	done := make(chan bool)
+	go func() {
+		deleted, err := s.ReapUpload(upload.ID, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Error(err)
+		}
+		done <- deleted
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("upload reaped while a chunk was being written")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+
+	if deleted := <-done; !deleted {
+		t.Fatal("stale upload was not reaped")
+	}
+	if _, err := s.GetUpload(upload.ID); err != ErrTusUploadNotFound {
+		t.Errorf("GetUpload after reap = %v, want %v", err, ErrTusUploadNotFound)
+	}
+	files, err := chunkFiles(upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("chunks left after reap: %v", files)
+	}
+	if _, err := s.WriteChunk(upload.ID, 5, bytes.NewReader([]byte("world"))); err != ErrTusUploadNotFound {
+		t.Errorf("WriteChunk after reap = %v, want %v", err, ErrTusUploadNotFound)
+	}
+}
+
+func TestReapUploadSkipsActiveUpload(t *testing.T) {
+	s := newTestTusService(t)
+	upload, err := s.CreateUpload(model.TusUpload{Length: 10, FileName: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteChunk(upload.ID, 0, bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// 查询待清理任务之后又收到了分片
+	deleted, err := s.ReapUpload(upload.ID, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted {
+		t.Fatal("active upload was reaped")
+	}
+	if _, err := s.WriteChunk(upload.ID, 5, bytes.NewReader([]byte("world"))); err != nil {
+		t.Fatal(err)
+	}
+}
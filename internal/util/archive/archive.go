@@ -0,0 +1,136 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+const (
+	ARCHIVE_FORMAT_ZIP    = "zip"
+	ARCHIVE_FORMAT_TAR_GZ = "tar.gz"
+)
+
+var ErrUnsupportedFormat = errors.New(model.ARCHIVE_FORMAT_UNSUPPORTED)
+
+// Entry 压缩包中的一个文件,内容在写入时才打开
+type Entry struct {
+	Name       string
+	Size       int64
+	ModTime    time.Time
+	Compressed bool // 内容已经是压缩格式(如图片、视频),zip中直接存储不再压缩
+	Open       func() (io.ReadCloser, error)
+}
+
+// NormalizeFormat 校验压缩格式,为空时使用zip,tgz视为tar.gz
+func NormalizeFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", ARCHIVE_FORMAT_ZIP:
+		return ARCHIVE_FORMAT_ZIP, nil
+	case ARCHIVE_FORMAT_TAR_GZ, "tgz":
+		return ARCHIVE_FORMAT_TAR_GZ, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// ContentType 压缩格式对应的MIME类型
+func ContentType(format string) string {
+	if format == ARCHIVE_FORMAT_TAR_GZ {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// Write 以流的方式将文件逐个写入压缩包,不使用临时文件
+func Write(w io.Writer, format string, entries []Entry) error {
+	names := uniqueNames(entries)
+	switch format {
+	case ARCHIVE_FORMAT_ZIP:
+		return writeZip(w, entries, names)
+	case ARCHIVE_FORMAT_TAR_GZ:
+		return writeTarGz(w, entries, names)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+func writeZip(w io.Writer, entries []Entry, names []string) error {
+	zw := zip.NewWriter(w)
+	for i, entry := range entries {
+		method := zip.Deflate
+		if entry.Compressed {
+			method = zip.Store
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     names[i],
+			Method:   method,
+			Modified: entry.ModTime,
+		})
+		if err != nil {
+			return err
+		}
+		if err := copyEntry(fw, entry); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, entries []Entry, names []string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for i, entry := range entries {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    names[i],
+			Mode:    0644,
+			Size:    entry.Size,
+			ModTime: entry.ModTime,
+		}); err != nil {
+			return err
+		}
+		if err := copyEntry(tw, entry); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func copyEntry(w io.Writer, entry Entry) error {
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// uniqueNames 去掉文件名中的路径,重名的文件追加序号,如 a.txt、a (1).txt
+func uniqueNames(entries []Entry) []string {
+	names := make([]string, len(entries))
+	used := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		name := path.Base(strings.ReplaceAll(entry.Name, "\\", "/"))
+		if name == "." || name == "/" || name == ".." {
+			name = "file"
+		}
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for n := 1; used[name]; n++ {
+			name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
@@ -0,0 +1,207 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+		err    bool
+	}{
+		{format: "", want: ARCHIVE_FORMAT_ZIP},
+		{format: "zip", want: ARCHIVE_FORMAT_ZIP},
+		{format: "ZIP", want: ARCHIVE_FORMAT_ZIP},
+		{format: "tar.gz", want: ARCHIVE_FORMAT_TAR_GZ},
+		{format: "tgz", want: ARCHIVE_FORMAT_TAR_GZ},
+		{format: "TGZ", want: ARCHIVE_FORMAT_TAR_GZ},
+		{format: "rar", err: true},
+		{format: "tar", err: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeFormat(tt.format)
+		if tt.err {
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("NormalizeFormat(%q) = %q, %v; want %v", tt.format, got, err, ErrUnsupportedFormat)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeFormat(%q) = %q, %v; want %q", tt.format, got, err, tt.want)
+		}
+	}
+}
+
+func TestUniqueNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{name: "distinct", names: []string{"a.txt", "b.txt"}, want: []string{"a.txt", "b.txt"}},
+		{name: "duplicates", names: []string{"a.txt", "a.txt", "a.txt"}, want: []string{"a.txt", "a (1).txt", "a (2).txt"}},
+		{name: "no extension", names: []string{"README", "README"}, want: []string{"README", "README (1)"}},
+		// 追加序号后的名称与已有文件重名时继续递增
+		{name: "numbered name taken", names: []string{"a (1).txt", "a.txt", "a.txt"}, want: []string{"a (1).txt", "a.txt", "a (2).txt"}},
+		{name: "paths removed", names: []string{"../../etc/passwd", "dir/a.txt", `C:\Users\a.txt`}, want: []string{"passwd", "a.txt", "a (1).txt"}},
+		{name: "empty and dots", names: []string{"", ".", "..", "/"}, want: []string{"file", "file (1)", "file (2)", "file (3)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make([]Entry, len(tt.names))
+			for i, name := range tt.names {
+				entries[i].Name = name
+			}
+			if got := uniqueNames(entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueNames(%q) = %q, want %q", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func textEntry(name, content string, compressed bool) Entry {
+	return Entry{
+		Name:       name,
+		Size:       int64(len(content)),
+		ModTime:    time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC),
+		Compressed: compressed,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	entries := []Entry{
+		textEntry("a.txt", strings.Repeat("text ", 100), false),
+		textEntry("dir/a.txt", "second", false),
+		textEntry("photo.jpg", "jpeg data", true),
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, ARCHIVE_FORMAT_ZIP, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name    string
+		content string
+		method  uint16
+	}{
+		{name: "a.txt", content: strings.Repeat("text ", 100), method: zip.Deflate},
+		{name: "a (1).txt", content: "second", method: zip.Deflate},
+		// 已压缩的文件直接存储
+		{name: "photo.jpg", content: "jpeg data", method: zip.Store},
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("zip has %d files, want %d", len(zr.File), len(want))
+	}
+	for i, file := range zr.File {
+		if file.Name != want[i].name || file.Method != want[i].method {
+			t.Errorf("file %d = %s (method %d), want %s (method %d)", i, file.Name, file.Method, want[i].name, want[i].method)
+		}
+		if !file.Modified.Equal(entries[i].ModTime) {
+			t.Errorf("%s modified = %v, want %v", file.Name, file.Modified, entries[i].ModTime)
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want[i].content {
+			t.Errorf("%s content = %q, want %q", file.Name, content, want[i].content)
+		}
+	}
+}
+
+func TestWriteTarGz(t *testing.T) {
+	entries := []Entry{
+		textEntry("a.txt", "first", false),
+		textEntry("a.txt", "second", true),
+		textEntry("empty.txt", "", false),
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, ARCHIVE_FORMAT_TAR_GZ, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	want := map[string]string{"a.txt": "first", "a (1).txt": "second", "empty.txt": ""}
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want[header.Name] {
+			t.Errorf("%s content = %q, want %q", header.Name, content, want[header.Name])
+		}
+		if !header.ModTime.Equal(entries[0].ModTime) {
+			t.Errorf("%s modTime = %v, want %v", header.Name, header.ModTime, entries[0].ModTime)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"a.txt", "a (1).txt", "empty.txt"}) {
+		t.Errorf("tar entries = %q", names)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	if err := Write(io.Discard, "rar", nil); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Write(rar) = %v, want %v", err, ErrUnsupportedFormat)
+	}
+
+	// 打开文件失败时中断写入并返回错误
+	openErr := errors.New("open failed")
+	failing := Entry{Name: "b.txt", Open: func() (io.ReadCloser, error) { return nil, openErr }}
+	for _, format := range []string{ARCHIVE_FORMAT_ZIP, ARCHIVE_FORMAT_TAR_GZ} {
+		entries := []Entry{textEntry("a.txt", "ok", false), failing}
+		if err := Write(io.Discard, format, entries); !errors.Is(err, openErr) {
+			t.Errorf("Write(%s) with failing entry = %v, want %v", format, err, openErr)
+		}
+	}
+
+	// tar中的文件大小与实际内容不一致时返回错误
+	short := textEntry("short.txt", "abc", false)
+	short.Size = 10
+	if err := Write(io.Discard, ARCHIVE_FORMAT_TAR_GZ, []Entry{short, textEntry("next.txt", "x", false)}); err == nil {
+		t.Error("Write(tar.gz) with wrong size succeeded")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	if got := ContentType(ARCHIVE_FORMAT_ZIP); got != "application/zip" {
+		t.Errorf("ContentType(zip) = %q", got)
+	}
+	if got := ContentType(ARCHIVE_FORMAT_TAR_GZ); got != "application/gzip" {
+		t.Errorf("ContentType(tar.gz) = %q", got)
+	}
+}
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+const (
+	CODE_TYPE_NUMERIC = "numeric" // 纯数字
+	CODE_TYPE_BASE32  = "base32"  // Crockford base32,去掉了容易混淆的 I L O U
+	CODE_TYPE_WORDS   = "words"   // 多个单词组成,便于口述
+	CODE_TYPE_CUSTOM  = "custom"  // 使用配置的字符集
+
+	NUMERIC_ALPHABET = "0123456789"
+	BASE32_ALPHABET  = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	DEFAULT_CODE_LENGTH      = 6
+	DEFAULT_WORD_COUNT       = 3
+	DEFAULT_WORD_SEPARATOR   = "-"
+	DEFAULT_CUSTOM_MIN       = 4
+	DEFAULT_CUSTOM_MAX       = 32
+	DEFAULT_CUSTOM_PATTERN   = `^[A-Za-z0-9_-]+$`
+	DEFAULT_COLLISION_RETRY  = 5
+	MIN_GENERATED_CODE_SPACE = 10000 // 生成的访问码至少需要的组合数,过小时很容易被猜中
+)
+
+var (
+	ErrInvalidCodeConfig = errors.New(model.INVALID_CODE_CONFIG)
+	ErrInvalidCustomCode = errors.New(model.INVALID_CUSTOM_CODE)
+)
+
+// Generator 访问码生成器
+type Generator interface {
+	// Generate 生成一个随机访问码
+	Generate() (string, error)
+	// Validate 校验用户自定义的访问码
+	Validate(custom string) error
+	// Retries 访问码冲突时的最大重试次数
+	Retries() int
+}
+
+type generator struct {
+	symbols   []string // 每一位可选的符号,字符或单词
+	length    int
+	separator string
+	minCustom int
+	maxCustom int
+	pattern   *regexp.Regexp
+	retries   int
+}
+
+// NewGenerator 根据配置创建访问码生成器
+func NewGenerator() (Generator, error) {
+	cfg := config.Config.Code
+	g := &generator{
+		length:    cfg.Length,
+		minCustom: cfg.Custom.MinLength,
+		maxCustom: cfg.Custom.MaxLength,
+		retries:   cfg.Retries,
+	}
+
+	switch cfg.Type {
+	case CODE_TYPE_NUMERIC, "":
+		g.symbols = strings.Split(NUMERIC_ALPHABET, "")
+	case CODE_TYPE_BASE32:
+		g.symbols = strings.Split(BASE32_ALPHABET, "")
+	case CODE_TYPE_WORDS:
+		g.symbols = cfg.Words
+		if len(g.symbols) == 0 {
+			g.symbols = defaultWords
+		}
+		g.separator = cfg.Separator
+		if g.separator == "" {
+			g.separator = DEFAULT_WORD_SEPARATOR
+		}
+		if g.length <= 0 {
+			g.length = DEFAULT_WORD_COUNT
+		}
+	case CODE_TYPE_CUSTOM:
+		g.symbols = strings.Split(cfg.Alphabet, "")
+	default:
+		return nil, fmt.Errorf("%w: 不支持的类型 %s", ErrInvalidCodeConfig, cfg.Type)
+	}
+
+	if g.length <= 0 {
+		g.length = DEFAULT_CODE_LENGTH
+	}
+	if g.minCustom <= 0 {
+		g.minCustom = DEFAULT_CUSTOM_MIN
+	}
+	if g.maxCustom <= 0 {
+		g.maxCustom = DEFAULT_CUSTOM_MAX
+	}
+	if g.retries <= 0 {
+		g.retries = DEFAULT_COLLISION_RETRY
+	}
+	pattern := cfg.Custom.Pattern
+	if pattern == "" {
+		pattern = DEFAULT_CUSTOM_PATTERN
+	}
+
+	var err error
+	if g.pattern, err = regexp.Compile(pattern); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCodeConfig, err)
+	}
+	if err := g.check(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// check 校验字符集,重复的符号会降低随机性,组合数过少时容易被猜中
+func (g *generator) check() error {
+	seen := make(map[string]bool, len(g.symbols))
+	for _, symbol := range g.symbols {
+		if symbol == "" || seen[symbol] {
+			return fmt.Errorf("%w: 字符集为空或包含重复的字符", ErrInvalidCodeConfig)
+		}
+		seen[symbol] = true
+	}
+	if len(g.symbols) < 2 {
+		return fmt.Errorf("%w: 字符集至少需要2个字符", ErrInvalidCodeConfig)
+	}
+
+	space := new(big.Int).Exp(big.NewInt(int64(len(g.symbols))), big.NewInt(int64(g.length)), nil)
+	if space.Cmp(big.NewInt(MIN_GENERATED_CODE_SPACE)) < 0 {
+		return fmt.Errorf("%w: 访问码组合数少于%d", ErrInvalidCodeConfig, MIN_GENERATED_CODE_SPACE)
+	}
+	if g.minCustom > g.maxCustom {
+		return fmt.Errorf("%w: 自定义访问码最小长度大于最大长度", ErrInvalidCodeConfig)
+	}
+	return nil
+}
+
+func (g *generator) Generate() (string, error) {
+	parts := make([]string, g.length)
+	max := big.NewInt(int64(len(g.symbols)))
+	for i := range parts {
+		// 使用密码学安全的随机数选择每一位
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = g.symbols[n.Int64()]
+	}
+	return strings.Join(parts, g.separator), nil
+}
+
+func (g *generator) Validate(custom string) error {
+	length := utf8.RuneCountInString(custom)
+	if length < g.minCustom || length > g.maxCustom {
+		return fmt.Errorf("%w: 长度需要在%d到%d个字符之间", ErrInvalidCustomCode, g.minCustom, g.maxCustom)
+	}
+	if !g.pattern.MatchString(custom) {
+		return fmt.Errorf("%w: 包含不允许的字符", ErrInvalidCustomCode)
+	}
+	return nil
+}
+
+func (g *generator) Retries() int {
+	return g.retries
+}
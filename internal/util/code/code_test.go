@@ -0,0 +1,173 @@
+package util
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/WindyDante/toolpost/internal/config"
+)
+
+// newTestGenerator 使用默认配置并按 configure 修改后创建生成器
+func newTestGenerator(t *testing.T, configure func(cfg *config.CodeConfig)) (Generator, error) {
+	t.Helper()
+	cfg, err := config.Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configure != nil {
+		configure(&cfg.Code)
+	}
+	config.Config = cfg
+	return NewGenerator()
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.CodeConfig)
+		pattern   string
+	}{
+		{name: "default", pattern: `^[0-9]{6}$`},
+		{
+			name:      "base32",
+			configure: func(cfg *config.CodeConfig) { cfg.Type = CODE_TYPE_BASE32; cfg.Length = 8 },
+			pattern:   `^[0-9A-HJKMNP-TV-Z]{8}$`,
+		},
+		{
+			name:      "words",
+			configure: func(cfg *config.CodeConfig) { cfg.Type = CODE_TYPE_WORDS; cfg.Length = 0; cfg.Separator = "." },
+			pattern:   `^[a-z]{4}\.[a-z]{4}\.[a-z]{4}$`,
+		},
+		{
+			name: "custom words",
+			configure: func(cfg *config.CodeConfig) {
+				cfg.Type = CODE_TYPE_WORDS
+				cfg.Length = 4
+				cfg.Words = []string{"red", "green", "blue", "pink", "gray", "gold", "teal", "navy", "lime", "plum", "rose"}
+			},
+			pattern: `^(red|green|blue|pink|gray|gold|teal|navy|lime|plum|rose)(-(red|green|blue|pink|gray|gold|teal|navy|lime|plum|rose)){3}$`,
+		},
+		{
+			name:      "custom alphabet",
+			configure: func(cfg *config.CodeConfig) { cfg.Type = CODE_TYPE_CUSTOM; cfg.Alphabet = "abcdefgh"; cfg.Length = 5 },
+			pattern:   `^[a-h]{5}$`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := newTestGenerator(t, tt.configure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pattern := regexp.MustCompile(tt.pattern)
+			seen := make(map[string]bool)
+			for i := 0; i < 50; i++ {
+				code, err := g.Generate()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !pattern.MatchString(code) {
+					t.Fatalf("Generate() = %q, want match %s", code, tt.pattern)
+				}
+				seen[code] = true
+			}
+			if len(seen) < 2 {
+				t.Errorf("Generate() returned the same code %d times", 50)
+			}
+		})
+	}
+}
+
+func TestNewGeneratorRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.CodeConfig)
+	}{
+		{name: "unknown type", configure: func(cfg *config.CodeConfig) { cfg.Type = "emoji" }},
+		{name: "duplicate symbols", configure: func(cfg *config.CodeConfig) { cfg.Type = CODE_TYPE_CUSTOM; cfg.Alphabet = "aabcdefg" }},
+		{name: "single symbol", configure: func(cfg *config.CodeConfig) { cfg.Type = CODE_TYPE_CUSTOM; cfg.Alphabet = "a"; cfg.Length = 32 }},
+		{name: "code space too small", configure: func(cfg *config.CodeConfig) { cfg.Length = 3 }},
+		{name: "min greater than max", configure: func(cfg *config.CodeConfig) { cfg.Custom.MinLength = 10; cfg.Custom.MaxLength = 5 }},
+		{name: "invalid pattern", configure: func(cfg *config.CodeConfig) { cfg.Custom.Pattern = "[" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTestGenerator(t, tt.configure); !errors.Is(err, ErrInvalidCodeConfig) {
+				t.Errorf("NewGenerator() = %v, want %v", err, ErrInvalidCodeConfig)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.CodeConfig)
+		custom    string
+		valid     bool
+	}{
+		{name: "default pattern", custom: "my_code-1", valid: true},
+		{name: "too short", custom: "abc"},
+		{name: "min length", custom: "abcd", valid: true},
+		{name: "max length", custom: strings.Repeat("a", 32), valid: true},
+		{name: "too long", custom: strings.Repeat("a", 33)},
+		{name: "space", custom: "my code"},
+		{name: "slash", custom: "../etc"},
+		{name: "non ascii", custom: "访问码测试"},
+		{
+			name:      "custom pattern",
+			configure: func(cfg *config.CodeConfig) { cfg.Custom.Pattern = `^[a-z]+$` },
+			custom:    "lower",
+			valid:     true,
+		},
+		{
+			name:      "custom pattern mismatch",
+			configure: func(cfg *config.CodeConfig) { cfg.Custom.Pattern = `^[a-z]+$` },
+			custom:    "Upper",
+		},
+		// 长度按字符计算而不是字节
+		{
+			name: "unicode length",
+			configure: func(cfg *config.CodeConfig) {
+				cfg.Custom.Pattern = `^\p{Han}+$`
+				cfg.Custom.MaxLength = 4
+			},
+			custom: "访问码测",
+			valid:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := newTestGenerator(t, tt.configure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = g.Validate(tt.custom)
+			if tt.valid && err != nil {
+				t.Errorf("Validate(%q) = %v, want nil", tt.custom, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidCustomCode) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.custom, err, ErrInvalidCustomCode)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	g, err := newTestGenerator(t, func(cfg *config.CodeConfig) { cfg.Retries = 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Retries() != DEFAULT_COLLISION_RETRY {
+		t.Errorf("Retries() = %d, want default %d", g.Retries(), DEFAULT_COLLISION_RETRY)
+	}
+	g, err = newTestGenerator(t, func(cfg *config.CodeConfig) { cfg.Retries = 2 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Retries() != 2 {
+		t.Errorf("Retries() = %d, want 2", g.Retries())
+	}
+}
@@ -0,0 +1,29 @@
+package util
+
+// defaultWords 单词访问码的默认词表,均为4个字母的常见英文单词,共256个
+var defaultWords = []string{
+	"able", "acid", "aged", "also", "area", "army", "away", "baby", "back", "ball", "band",
+	"bank", "base", "bath", "bear", "beat", "beef", "bell", "belt", "best", "bird", "blue",
+	"boat", "body", "bone", "book", "boot", "born", "boss", "both", "bowl", "bulk", "burn",
+	"bush", "busy", "cake", "calm", "camp", "card", "care", "cart", "case", "cash", "cast",
+	"cell", "chef", "chip", "city", "clay", "club", "coal", "coat", "code", "cold", "cook",
+	"cool", "cope", "copy", "core", "corn", "cost", "crew", "crop", "cube", "cure", "dark",
+	"data", "date", "dawn", "deal", "deck", "deep", "deer", "desk", "dial", "diet", "dirt",
+	"dish", "disk", "dock", "door", "dose", "down", "draw", "drum", "duck", "dust", "duty",
+	"earn", "east", "easy", "edge", "exit", "face", "fact", "fair", "farm", "fast", "fear",
+	"feed", "fern", "file", "film", "fine", "fire", "firm", "fish", "flag", "flat", "flow",
+	"foam", "fold", "folk", "font", "food", "foot", "fork", "form", "fort", "free", "frog",
+	"fuel", "full", "fund", "gain", "game", "gate", "gear", "gift", "girl", "glad", "glow",
+	"goal", "goat", "gold", "golf", "good", "gray", "grid", "grow", "gulf", "hair", "half",
+	"hall", "hand", "harp", "hawk", "head", "heat", "herb", "hero", "hill", "hint", "hold",
+	"home", "hood", "hook", "horn", "host", "hour", "huge", "idea", "inch", "iron", "item",
+	"jade", "jazz", "join", "joke", "jump", "jury", "keen", "keep", "kind", "king", "kite",
+	"knot", "lake", "lamp", "land", "lane", "last", "lava", "lawn", "lead", "leaf", "lens",
+	"life", "lift", "lime", "line", "link", "lion", "list", "load", "loan", "lock", "loft",
+	"long", "loop", "lord", "luck", "lung", "mail", "main", "mall", "malt", "many", "maps",
+	"mark", "mask", "math", "meal", "meat", "menu", "mild", "milk", "mind", "mint", "mist",
+	"mode", "moon", "moss", "moth", "move", "much", "nail", "name", "navy", "neat", "neck",
+	"nest", "news", "next", "nice", "node", "noon", "nose", "note", "oath", "oven", "pack",
+	"page", "pain", "pair", "palm", "park", "part", "path", "peak", "pear", "pier", "pine",
+	"pink", "pipe", "plan",
+}
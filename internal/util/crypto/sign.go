@@ -0,0 +1,85 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+var (
+	ErrNoSigningSecret  = errors.New(model.NO_SIGNING_SECRET)
+	ErrInvalidSignature = errors.New(model.INVALID_SIGNATURE)
+	ErrSignatureExpired = errors.New(model.SIGNATURE_EXPIRED)
+)
+
+// Signer 使用HMAC-SHA256对下载链接签名
+// 第一个密钥用于签名,所有密钥都可用于校验,轮换密钥时把新密钥放在最前面并保留旧密钥
+type Signer struct {
+	secrets [][]byte
+}
+
+func NewSigner(secrets []string) (*Signer, error) {
+	signer := &Signer{}
+	for _, secret := range secrets {
+		if secret != "" {
+			signer.secrets = append(signer.secrets, []byte(secret))
+		}
+	}
+	if len(signer.secrets) == 0 {
+		return nil, ErrNoSigningSecret
+	}
+	return signer, nil
+}
+
+// RandomSecret 生成随机签名密钥,未配置密钥时使用,重启后之前签发的链接失效
+func RandomSecret() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// Sign 对分享ID、访问码和过期时间签名,返回 "过期时间戳.签名"
+func (s *Signer) Sign(id string, code string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expires + "." + base64.RawURLEncoding.EncodeToString(s.mac(s.secrets[0], id, code, expires))
+}
+
+// Verify 校验签名和过期时间,任意一个有效密钥匹配即通过
+func (s *Signer) Verify(key string, id string, code string, now time.Time) error {
+	expires, encoded, found := strings.Cut(key, ".")
+	if !found {
+		return ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	for _, secret := range s.secrets {
+		if hmac.Equal(signature, s.mac(secret, id, code, expires)) {
+			// 先校验签名再判断过期,避免伪造的过期时间泄露信息
+			if now.Unix() > expiresAt {
+				return ErrSignatureExpired
+			}
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func (s *Signer) mac(secret []byte, id string, code string, expires string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(id + "\n" + code + "\n" + expires))
+	return h.Sum(nil)
+}
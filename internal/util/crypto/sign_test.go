@@ -0,0 +1,90 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewSignerRequiresSecret(t *testing.T) {
+	for _, secrets := range [][]string{nil, {}, {""}, {"", ""}} {
+		if _, err := NewSigner(secrets); !errors.Is(err, ErrNoSigningSecret) {
+			t.Errorf("NewSigner(%q) = %v, want %v", secrets, err, ErrNoSigningSecret)
+		}
+	}
+}
+
+func TestSignerVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer, err := NewSigner([]string{"secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := signer.Sign("id", "code", now.Add(time.Minute))
+
+	tests := []struct {
+		name string
+		key  string
+		id   string
+		code string
+		now  time.Time
+		want error
+	}{
+		{name: "valid", key: key, id: "id", code: "code", now: now},
+		{name: "at expiry", key: key, id: "id", code: "code", now: now.Add(time.Minute)},
+		{name: "expired", key: key, id: "id", code: "code", now: now.Add(time.Minute + time.Second), want: ErrSignatureExpired},
+		{name: "other share", key: key, id: "other", code: "code", now: now, want: ErrInvalidSignature},
+		{name: "other code", key: key, id: "id", code: "other", now: now, want: ErrInvalidSignature},
+		{name: "no separator", key: "abc", id: "id", code: "code", now: now, want: ErrInvalidSignature},
+		{name: "bad expiry", key: "x." + key[len("1700000060."):], id: "id", code: "code", now: now, want: ErrInvalidSignature},
+		{name: "bad encoding", key: "1700000060.!!", id: "id", code: "code", now: now, want: ErrInvalidSignature},
+		// 修改过期时间后签名不再匹配
+		{name: "extended expiry", key: "1800000000." + key[len("1700000060."):], id: "id", code: "code", now: now, want: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := signer.Verify(tt.key, tt.id, tt.code, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignerKeyRollover(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	expiresAt := now.Add(time.Hour)
+
+	old, err := NewSigner([]string{"old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := old.Sign("id", "code", expiresAt)
+
+	// 新密钥放在最前面用于签名,旧密钥签发的链接在过期前仍然有效
+	rotated, err := NewSigner([]string{"new", "", "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rotated.Verify(oldKey, "id", "code", now); err != nil {
+		t.Errorf("old link after rotation: %v", err)
+	}
+	newKey := rotated.Sign("id", "code", expiresAt)
+	if newKey == oldKey {
+		t.Fatal("rotated signer still signs with the old secret")
+	}
+	if err := old.Verify(newKey, "id", "code", now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("new link with old secret only = %v, want %v", err, ErrInvalidSignature)
+	}
+
+	// 删除旧密钥后旧链接失效
+	retired, err := NewSigner([]string{"new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := retired.Verify(oldKey, "id", "code", now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("old link after retiring the secret = %v, want %v", err, ErrInvalidSignature)
+	}
+	if err := retired.Verify(newKey, "id", "code", now); err != nil {
+		t.Errorf("new link after retiring the old secret: %v", err)
+	}
+}
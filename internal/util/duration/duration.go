@@ -0,0 +1,106 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+var (
+	ErrInvalidDuration = errors.New(model.INVALID_EXPIRE)
+	ErrUnsupportedUnit = errors.New(model.EXPIRE_UNIT_UNSUPPORTED)
+)
+
+// ParseDuration 解析时长,支持 ISO-8601 格式(如 PT1H、P7D、P1W、P1DT12H)和 Go 的时长格式(如 90m、1h30m)
+// 年和月的长度不固定,不支持使用
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, ErrInvalidDuration
+	}
+
+	var duration time.Duration
+	var err error
+	if strings.HasPrefix(strings.ToUpper(value), "P") {
+		duration, err = parseISO8601(strings.ToUpper(value))
+	} else if duration, err = time.ParseDuration(value); err != nil {
+		err = fmt.Errorf("%w: %s", ErrInvalidDuration, value)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidDuration, value)
+	}
+	return duration, nil
+}
+
+// parseISO8601 解析 ISO-8601 格式的时长,如 P1DT2H30M
+func parseISO8601(value string) (time.Duration, error) {
+	invalid := fmt.Errorf("%w: %s", ErrInvalidDuration, value)
+
+	rest := value[1:]
+	if rest == "" || rest == "T" {
+		return 0, invalid
+	}
+
+	var duration time.Duration
+	inTime := false
+	number := ""
+	for _, c := range rest {
+		switch {
+		case c == 'T':
+			if inTime || number != "" {
+				return 0, invalid
+			}
+			inTime = true
+		case (c >= '0' && c <= '9') || c == '.':
+			number += string(c)
+		default:
+			if number == "" {
+				return 0, invalid
+			}
+			n, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, invalid
+			}
+			unit, err := iso8601Unit(c, inTime)
+			if err != nil {
+				return 0, err
+			}
+			duration += time.Duration(n * float64(unit))
+			number = ""
+		}
+	}
+	// 数字后面缺少单位
+	if number != "" {
+		return 0, invalid
+	}
+	return duration, nil
+}
+
+// iso8601Unit 获取 ISO-8601 时长单位对应的长度,T之前的M表示月,之后的M表示分钟
+func iso8601Unit(c rune, inTime bool) (time.Duration, error) {
+	if inTime {
+		switch c {
+		case 'H':
+			return time.Hour, nil
+		case 'M':
+			return time.Minute, nil
+		case 'S':
+			return time.Second, nil
+		}
+	} else {
+		switch c {
+		case 'W':
+			return 7 * 24 * time.Hour, nil
+		case 'D':
+			return 24 * time.Hour, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %c", ErrUnsupportedUnit, c)
+}
@@ -7,10 +7,21 @@ import (
 
 var Logger *zap.Logger
 
+// level 日志级别,可以在运行时修改
+var level = zap.NewAtomicLevel()
+
 func InitLogger() {
+	loggerConfig := zap.NewProductionConfig()
+	loggerConfig.Level = level
+
 	var err error
-	Logger, err = zap.NewProduction()
+	Logger, err = loggerConfig.Build()
 	if err != nil {
 		panic(model.INIT_LOGGER_PANIC + ": " + err.Error())
 	}
 }
+
+// SetLevel 修改日志级别,立即对所有日志生效
+func SetLevel(text string) error {
+	return level.UnmarshalText([]byte(text))
+}
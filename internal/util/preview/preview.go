@@ -0,0 +1,175 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	model "github.com/WindyDante/toolpost/internal/model/common"
+	storageUtil "github.com/WindyDante/toolpost/internal/util/storage"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册WebP解码器
+)
+
+const (
+	THUMBNAIL_JPEG_QUALITY = 80
+)
+
+var (
+	ErrImageTooLarge = errors.New(model.PREVIEW_IMAGE_TOO_LARGE)
+)
+
+// IsImage 是否为可以生成缩略图的图片类型
+// PDF不生成缩略图:渲染PDF需要pdfium、poppler等非Go的外部依赖,
+// PDF通过下载链接的 inline=true 交给浏览器在线预览
+func IsImage(mimeType string) bool {
+	switch mediaType(mimeType) {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// IsText 是否为可以直接展示的文本类型
+func IsText(mimeType string) bool {
+	mediaType := mediaType(mimeType)
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-javascript",
+		"application/x-sh", "application/x-yaml", "application/yaml", "application/toml", "application/sql":
+		return true
+	}
+	return false
+}
+
+// IsPDF 是否为PDF文件,PDF不支持生成缩略图
+func IsPDF(mimeType string) bool {
+	return mediaType(mimeType) == "application/pdf"
+}
+
+func mediaType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return mimeType
+	}
+	return mediaType
+}
+
+// Thumbnail 生成不超过 maxDimension 的缩略图
+// 先读取图片尺寸,像素数超过 maxPixels 时不解码,防止解压炸弹占用大量内存
+// 原图为JPEG时输出JPEG,其余格式可能带透明通道,输出PNG
+func Thumbnail(r io.Reader, maxDimension int, maxPixels int64) ([]byte, string, error) {
+	var head bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&head, r))
+	if err != nil {
+		return nil, "", err
+	}
+
+	width, height := fitSize(src.Bounds().Dx(), src.Bounds().Dy(), maxDimension)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: THUMBNAIL_JPEG_QUALITY})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+// fitSize 按比例缩放到最长边不超过 maxDimension,小图保持原尺寸
+func fitSize(width, height, maxDimension int) (int, int) {
+	if width <= maxDimension && height <= maxDimension {
+		return width, height
+	}
+	if width >= height {
+		return maxDimension, max(1, height*maxDimension/width)
+	}
+	return max(1, width*maxDimension/height), maxDimension
+}
+
+// TruncateText 截取不超过 limit 字节的文本,不截断多字节字符,返回是否被截断
+func TruncateText(data []byte, limit int) ([]byte, bool) {
+	if len(data) <= limit {
+		return data, false
+	}
+	data = data[:limit]
+	// 最多回退3个字节找到完整的UTF-8字符边界
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+	return data, true
+}
+
+// Cache 缩略图的磁盘缓存,以文件内容哈希和尺寸作为key,不同分享中相同的文件共用缓存
+// 开启加密时缓存与分享文件一样加密保存
+type Cache struct {
+	dir     string
+	storage storageUtil.Storage
+}
+
+// NewCache 根据配置创建缩略图缓存
+func NewCache() (*Cache, error) {
+	dir := config.Config.Preview.CachePath
+	storage, err := storageUtil.NewLocalScratch(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, storage: storage}, nil
+}
+
+func (c *Cache) key(key string, size int) string {
+	return fmt.Sprintf("%s_%d", filepath.Base(key), size)
+}
+
+// Get 读取缓存的缩略图,不存在或无法解密时返回错误,调用方重新生成即可
+func (c *Cache) Get(key string, size int) ([]byte, error) {
+	r, err := c.storage.Get(c.key(key, size))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Put 写入缓存,存储先写入临时文件再重命名,并发生成同一个缩略图时不会读到不完整的文件
+func (c *Cache) Put(key string, size int, data []byte) error {
+	_, err := c.storage.Put(c.key(key, size), bytes.NewReader(data))
+	return err
+}
+
+// Remove 删除key对应的所有尺寸的缩略图,包括加密时的数据密钥文件
+func (c *Cache) Remove(key string) error {
+	matches, err := filepath.Glob(filepath.Join(c.dir, filepath.Base(key)+"_*"))
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
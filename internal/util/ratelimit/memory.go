@@ -0,0 +1,134 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	SWEEP_INTERVAL = time.Minute // 清理空闲状态的间隔
+)
+
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	expires time.Time // 令牌桶补满的时间,之后可以安全地清理
+}
+
+type lockout struct {
+	misses      int
+	level       int // 已经锁定的次数,用于计算下一次锁定时长
+	lastMiss    time.Time
+	lockedUntil time.Time
+	expires     time.Time // 失败计数和锁定等级都失效的时间,之后可以安全地清理
+}
+
+// MemoryStore 基于内存的限流状态存储,只适用于单实例部署
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lockouts  map[string]*lockout
+	lastSweep time.Time
+}
+
+func NewMemoryStore() Store {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		lockouts: make(map[string]*lockout),
+	}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit, now time.Time) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+
+	// 按经过的时间补充令牌
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+
+	var wait time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		wait = time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	b.expires = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+	return wait
+}
+
+func (m *MemoryStore) RecordMiss(key string, policy LockoutPolicy, now time.Time) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+
+	l, ok := m.lockouts[key]
+	if !ok {
+		l = &lockout{}
+		m.lockouts[key] = l
+	}
+
+	// 超出统计窗口的失败不再计数,长时间没有失败时重置锁定等级
+	if now.Sub(l.lastMiss) > policy.Window {
+		l.misses = 0
+	}
+	if now.Sub(l.lastMiss) > policy.MaxDuration {
+		l.level = 0
+	}
+	l.lastMiss = now
+	l.misses++
+
+	if l.misses >= policy.Threshold {
+		duration := policy.Duration << l.level
+		if duration <= 0 || duration > policy.MaxDuration {
+			duration = policy.MaxDuration
+		} else {
+			l.level++
+		}
+		l.lockedUntil = now.Add(duration)
+		l.misses = 0
+	}
+	l.expires = now.Add(max(policy.Window, policy.MaxDuration))
+	if l.lockedUntil.After(l.expires) {
+		l.expires = l.lockedUntil
+	}
+	return l.lockedUntil
+}
+
+func (m *MemoryStore) LockedUntil(key string, now time.Time) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, ok := m.lockouts[key]; ok {
+		return l.lockedUntil
+	}
+	return time.Time{}
+}
+
+// sweep 定期清理已经失效的状态,避免内存无限增长,调用方需持有锁
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < SWEEP_INTERVAL {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if now.After(b.expires) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, l := range m.lockouts {
+		if now.After(l.expires) {
+			delete(m.lockouts, key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"math"
+	"time"
+)
+
+// Limit 令牌桶参数,Rate或Burst不大于0时不限流
+type Limit struct {
+	Rate  float64 // 每秒补充的令牌数
+	Burst int     // 桶容量,允许的突发请求数
+}
+
+// LockoutPolicy 连续失败后的锁定策略
+// 在Window内失败达到Threshold次后锁定,每次锁定时长翻倍,最长不超过MaxDuration
+type LockoutPolicy struct {
+	Threshold   int
+	Window      time.Duration
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// Store 限流状态的存储,默认使用内存存储,多实例部署时可替换为共享存储
+type Store interface {
+	// Take 从key对应的令牌桶取出一个令牌,返回0表示允许,否则返回需要等待的时间
+	Take(key string, limit Limit, now time.Time) time.Duration
+	// RecordMiss 记录一次失败,返回锁定的到期时间,未锁定时返回零值
+	RecordMiss(key string, policy LockoutPolicy, now time.Time) time.Time
+	// LockedUntil 返回key的锁定到期时间,未锁定时返回零值
+	LockedUntil(key string, now time.Time) time.Time
+}
+
+// Limiter 按客户端IP和分享码限流,并在连续失败后锁定客户端IP
+type Limiter struct {
+	store   Store
+	ip      Limit
+	code    Limit
+	lockout LockoutPolicy
+}
+
+func NewLimiter(store Store, ip Limit, code Limit, lockout LockoutPolicy) *Limiter {
+	return &Limiter{
+		store:   store,
+		ip:      ip,
+		code:    code,
+		lockout: lockout,
+	}
+}
+
+// Allow 判断请求是否允许,返回0表示允许,否则返回需要等待的时间
+func (l *Limiter) Allow(ip string, code string, now time.Time) time.Duration {
+	if wait := l.Locked(ip, now); wait > 0 {
+		return wait
+	}
+	if l.ip.enabled() {
+		if wait := l.store.Take("ip:"+ip, l.ip, now); wait > 0 {
+			return wait
+		}
+	}
+	if code != "" && l.code.enabled() {
+		if wait := l.store.Take("code:"+code, l.code, now); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// Locked 客户端IP是否因失败次数过多被锁定,返回0表示未锁定,否则返回需要等待的时间
+func (l *Limiter) Locked(ip string, now time.Time) time.Duration {
+	if until := l.store.LockedUntil("lock:"+ip, now); until.After(now) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+// Miss 记录一次失败的访问(分享码不存在、密码错误等)
+func (l *Limiter) Miss(ip string, now time.Time) {
+	if l.lockout.Threshold <= 0 {
+		return
+	}
+	l.store.RecordMiss("lock:"+ip, l.lockout, now)
+}
+
+func (l Limit) enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// RetryAfterSeconds 将等待时间转换为Retry-After需要的秒数,至少为1秒
+func RetryAfterSeconds(wait time.Duration) int {
+	return int(math.Max(1, math.Ceil(wait.Seconds())))
+}
@@ -0,0 +1,230 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// missTimes 在 at 时刻连续失败 n 次,返回最后一次的锁定到期时间
+func missTimes(store Store, policy LockoutPolicy, at time.Time, n int) time.Time {
+	var until time.Time
+	for i := 0; i < n; i++ {
+		until = store.RecordMiss("ip", policy, at)
+	}
+	return until
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	policy := LockoutPolicy{
+		Threshold:   3,
+		Window:      10 * time.Minute,
+		Duration:    time.Minute,
+		MaxDuration: 10 * time.Minute,
+	}
+	store := NewMemoryStore()
+
+	// 每次锁定时长翻倍,超过上限后保持上限
+	steps := []struct {
+		after time.Duration // 距离上一次失败的时间
+		want  time.Duration
+	}{
+		{after: 0, want: time.Minute},
+		{after: 2 * time.Minute, want: 2 * time.Minute},
+		{after: 3 * time.Minute, want: 4 * time.Minute},
+		{after: 5 * time.Minute, want: 8 * time.Minute},
+		{after: 9 * time.Minute, want: 10 * time.Minute},
+		{after: 10 * time.Minute, want: 10 * time.Minute},
+	}
+	now := testNow
+	for i, step := range steps {
+		now = now.Add(step.after)
+		if until := missTimes(store, policy, now, policy.Threshold-1); until.After(now) {
+			t.Fatalf("step %d: locked after %d misses", i, policy.Threshold-1)
+		}
+		until := store.RecordMiss("ip", policy, now)
+		if got := until.Sub(now); got != step.want {
+			t.Errorf("step %d: lockout = %v, want %v", i, got, step.want)
+		}
+		if got := store.LockedUntil("ip", now); !got.Equal(until) {
+			t.Errorf("step %d: LockedUntil = %v, want %v", i, got, until)
+		}
+	}
+
+	// 超过 MaxDuration 没有失败后重新从最短的锁定时长开始
+	now = now.Add(policy.MaxDuration + time.Second)
+	if got := missTimes(store, policy, now, policy.Threshold).Sub(now); got != policy.Duration {
+		t.Errorf("lockout after quiet period = %v, want %v", got, policy.Duration)
+	}
+}
+
+func TestLockoutWindow(t *testing.T) {
+	policy := LockoutPolicy{
+		Threshold:   3,
+		Window:      time.Minute,
+		Duration:    time.Minute,
+		MaxDuration: time.Hour,
+	}
+	store := NewMemoryStore()
+
+	// 两次失败之间超过统计窗口时重新计数
+	now := testNow
+	for i := 0; i < 5; i++ {
+		now = now.Add(policy.Window + time.Second)
+		if until := store.RecordMiss("ip", policy, now); !until.IsZero() {
+			t.Fatalf("miss %d locked until %v, want not locked", i, until)
+		}
+	}
+	// 窗口内的失败累计计数
+	now = now.Add(policy.Window - time.Second)
+	if until := store.RecordMiss("ip", policy, now); !until.IsZero() {
+		t.Fatalf("second miss in window locked until %v", until)
+	}
+	if until := store.RecordMiss("ip", policy, now); until.Sub(now) != policy.Duration {
+		t.Errorf("third miss in window locked for %v, want %v", until.Sub(now), policy.Duration)
+	}
+}
+
+func TestLockoutOverflow(t *testing.T) {
+	// 锁定时长左移溢出时使用上限,不会出现负数或零
+	policy := LockoutPolicy{
+		Threshold:   1,
+		Window:      time.Minute,
+		Duration:    time.Hour,
+		MaxDuration: 1 << 62,
+	}
+	store := NewMemoryStore()
+	now := testNow
+	previous := time.Duration(0)
+	for i := 0; i < 70; i++ {
+		until := store.RecordMiss("ip", policy, now)
+		lockout := until.Sub(now)
+		if lockout < previous || lockout <= 0 || lockout > policy.MaxDuration {
+			t.Fatalf("miss %d: lockout = %v after %v", i, lockout, previous)
+		}
+		previous = lockout
+		now = now.Add(time.Second)
+	}
+	if previous != policy.MaxDuration {
+		t.Errorf("lockout after 70 misses = %v, want %v", previous, policy.MaxDuration)
+	}
+}
+
+func TestTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < limit.Burst; i++ {
+		if wait := store.Take("key", limit, testNow); wait != 0 {
+			t.Fatalf("request %d within burst waited %v", i, wait)
+		}
+	}
+	if wait := store.Take("key", limit, testNow); wait != 500*time.Millisecond {
+		t.Errorf("request over burst wait = %v, want 500ms", wait)
+	}
+	// 按速率补充令牌,补充的令牌不超过桶容量
+	if wait := store.Take("key", limit, testNow.Add(500*time.Millisecond)); wait != 0 {
+		t.Errorf("request after refill waited %v", wait)
+	}
+	later := testNow.Add(time.Hour)
+	for i := 0; i < limit.Burst; i++ {
+		if wait := store.Take("key", limit, later); wait != 0 {
+			t.Fatalf("request %d after long idle waited %v", i, wait)
+		}
+	}
+	if wait := store.Take("key", limit, later); wait == 0 {
+		t.Error("bucket refilled beyond burst")
+	}
+	// 不同的key使用各自的令牌桶
+	if wait := store.Take("other", limit, later); wait != 0 {
+		t.Errorf("other key waited %v", wait)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 2, Window: time.Minute, Duration: time.Minute, MaxDuration: time.Hour}
+	limiter := NewLimiter(NewMemoryStore(), Limit{Rate: 1, Burst: 2}, Limit{Rate: 1, Burst: 1}, policy)
+
+	if wait := limiter.Allow("1.1.1.1", "code", testNow); wait != 0 {
+		t.Fatalf("first request waited %v", wait)
+	}
+	// 同一个访问码的请求超过限制,其他访问码不受影响
+	if wait := limiter.Allow("2.2.2.2", "code", testNow); wait == 0 {
+		t.Error("code limit not applied across clients")
+	}
+	if wait := limiter.Allow("3.3.3.3", "other", testNow); wait != 0 {
+		t.Errorf("other code waited %v", wait)
+	}
+	if wait := limiter.Allow("1.1.1.1", "", testNow); wait != 0 {
+		t.Errorf("second request from ip waited %v", wait)
+	}
+	if wait := limiter.Allow("1.1.1.1", "", testNow); wait == 0 {
+		t.Error("ip limit not applied")
+	}
+
+	// 连续失败后锁定客户端IP
+	limiter.Miss("4.4.4.4", testNow)
+	if wait := limiter.Locked("4.4.4.4", testNow); wait != 0 {
+		t.Fatalf("locked after one miss: %v", wait)
+	}
+	limiter.Miss("4.4.4.4", testNow)
+	if wait := limiter.Allow("4.4.4.4", "", testNow.Add(time.Second)); wait != time.Minute-time.Second {
+		t.Errorf("locked ip wait = %v, want %v", wait, time.Minute-time.Second)
+	}
+	if wait := limiter.Locked("4.4.4.4", testNow.Add(time.Minute)); wait != 0 {
+		t.Errorf("still locked after lockout expired: %v", wait)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), Limit{}, Limit{Rate: 1}, LockoutPolicy{Duration: time.Minute})
+	for i := 0; i < 100; i++ {
+		if wait := limiter.Allow("ip", "code", testNow); wait != 0 {
+			t.Fatalf("request %d waited %v with limits disabled", i, wait)
+		}
+		limiter.Miss("ip", testNow)
+	}
+	if wait := limiter.Locked("ip", testNow); wait != 0 {
+		t.Errorf("locked with lockout disabled: %v", wait)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	store := NewMemoryStore().(*MemoryStore)
+	policy := LockoutPolicy{Threshold: 1, Window: time.Minute, Duration: time.Minute, MaxDuration: 5 * time.Minute}
+	store.Take("bucket", Limit{Rate: 1, Burst: 10}, testNow)
+	store.RecordMiss("lock", policy, testNow)
+
+	// 状态失效前不清理
+	store.Take("trigger", Limit{Rate: 1, Burst: 1}, testNow.Add(2*SWEEP_INTERVAL))
+	if _, ok := store.lockouts["lock"]; !ok {
+		t.Error("lockout swept before it expired")
+	}
+	later := testNow.Add(time.Hour)
+	store.Take("trigger", Limit{Rate: 1, Burst: 1}, later)
+	if _, ok := store.buckets["bucket"]; ok {
+		t.Error("full bucket not swept")
+	}
+	if _, ok := store.lockouts["lock"]; ok {
+		t.Error("expired lockout not swept")
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{wait: 0, want: 1},
+		{wait: time.Millisecond, want: 1},
+		{wait: time.Second, want: 1},
+		{wait: 1001 * time.Millisecond, want: 2},
+		{wait: time.Minute, want: 60},
+	}
+	for _, tt := range tests {
+		if got := RetryAfterSeconds(tt.wait); got != tt.want {
+			t.Errorf("RetryAfterSeconds(%v) = %d, want %d", tt.wait, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package util
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+const (
+	ENVELOPE_SUFFIX    = ".key"    // 数据密钥文件的后缀,与加密文件保存在同一个存储中
+	ENVELOPE_VERSION   = 1         // 数据密钥文件的格式版本
+	DEFAULT_CHUNK_SIZE = 64 * 1024 // 未配置时每个加密分块的明文大小
+	MAX_ENVELOPE_SIZE  = 4096      // 读取数据密钥文件的大小上限
+	GCM_TAG_SIZE       = 16        // 每个分块的认证标签大小
+)
+
+var (
+	ErrFileDecryptFailed = errors.New(model.FILE_DECRYPT_FAILED)
+)
+
+// envelope 加密文件的数据密钥,由主密钥加密后单独保存,轮换主密钥时只需要重写该文件
+type envelope struct {
+	Version   int    `json:"version"`
+	KeyID     string `json:"keyId"`     // 加密数据密钥的主密钥ID
+	DataKey   []byte `json:"dataKey"`   // 加密后的数据密钥
+	ChunkSize int    `json:"chunkSize"` // 每个分块的明文大小
+}
+
+// EncryptedStorage 在其他存储之上使用AES-256-GCM加密文件内容
+// 文件按固定大小分块加密,每块带认证标签,读取任意范围时只需解密涉及的分块
+// 分块的nonce由分块序号和是否为最后一块组成,每个文件使用随机的数据密钥,nonce不会重复
+// 没有数据密钥文件的旧文件按明文读取
+type EncryptedStorage struct {
+	storage   Storage
+	keys      *KeyRing
+	chunkSize int
+}
+
+func NewEncryptedStorage(storage Storage, keys *KeyRing, chunkSize int) *EncryptedStorage {
+	if chunkSize <= 0 {
+		chunkSize = DEFAULT_CHUNK_SIZE
+	}
+	return &EncryptedStorage{
+		storage:   storage,
+		keys:      keys,
+		chunkSize: chunkSize,
+	}
+}
+
+func (e *EncryptedStorage) Put(key string, r io.Reader) (int64, error) {
+	dataKey := make([]byte, DATA_KEY_SIZE)
+	if _, err := rand.Read(dataKey); err != nil {
+		return 0, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return 0, err
+	}
+	keyID, wrapped, err := e.keys.Wrap(dataKey)
+	if err != nil {
+		return 0, err
+	}
+
+	// 先写入数据密钥,避免文件写入后没有数据密钥被当作明文读取
+	if err := e.putEnvelope(key, envelope{
+		Version:   ENVELOPE_VERSION,
+		KeyID:     keyID,
+		DataKey:   wrapped,
+		ChunkSize: e.chunkSize,
+	}); err != nil {
+		return 0, err
+	}
+
+	// 边读取边加密,写入存储失败时关闭管道使加密协程退出
+	pr, pw := io.Pipe()
+	written := make(chan int64, 1)
+	go func() {
+		w := newChunkWriter(pw, aead, e.chunkSize)
+		n, err := io.Copy(w, r)
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+		written <- n
+	}()
+
+	_, err = e.storage.Put(key, pr)
+	pr.CloseWithError(io.ErrClosedPipe)
+	n := <-written
+	if err != nil {
+		e.storage.Delete(key + ENVELOPE_SUFFIX)
+		return 0, err
+	}
+	return n, nil
+}
+
+func (e *EncryptedStorage) Get(key string) (io.ReadCloser, error) {
+	return e.OpenRange(key, 0, -1)
+}
+
+// Stat 返回明文的大小
+func (e *EncryptedStorage) Stat(key string) (FileInfo, error) {
+	info, err := e.storage.Stat(key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	env, err := e.readEnvelope(key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if env != nil {
+		info.Size = plainSize(info.Size, env.ChunkSize)
+	}
+	return info, nil
+}
+
+// Delete 先删除文件再删除数据密钥,文件删除失败时数据密钥仍然可用
+func (e *EncryptedStorage) Delete(key string) error {
+	if err := e.storage.Delete(key); err != nil {
+		return err
+	}
+	return e.storage.Delete(key + ENVELOPE_SUFFIX)
+}
+
+// OpenRange 按明文的偏移量读取,只读取并解密范围涉及的分块
+func (e *EncryptedStorage) OpenRange(key string, offset, length int64) (io.ReadCloser, error) {
+	env, err := e.readEnvelope(key)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return e.storage.OpenRange(key, offset, length)
+	}
+
+	info, err := e.storage.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := int64(env.ChunkSize)
+	sealedSize := chunkSize + GCM_TAG_SIZE
+	chunks := (info.Size + sealedSize - 1) / sealedSize
+	size := plainSize(info.Size, env.ChunkSize)
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+	if length <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	dataKey, err := e.keys.Unwrap(env.KeyID, env.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	first := offset / chunkSize
+	last := (offset + length - 1) / chunkSize
+	body, err := e.storage.OpenRange(key, first*sealedSize, (last-first+1)*sealedSize)
+	if err != nil {
+		return nil, err
+	}
+	reader := &chunkReader{
+		r:     body,
+		aead:  aead,
+		index: uint64(first),
+		last:  uint64(chunks - 1),
+		buf:   make([]byte, sealedSize),
+	}
+	// 跳过第一个分块中偏移量之前的内容
+	if _, err := io.CopyN(io.Discard, reader, offset-first*chunkSize); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &limitReadCloser{
+		Reader: io.LimitReader(reader, length),
+		Closer: body,
+	}, nil
+}
+
+// Rewrap 使用当前主密钥重新加密文件的数据密钥,文件内容不变
+// 明文文件和已使用当前主密钥的文件返回false
+func (e *EncryptedStorage) Rewrap(key string) (bool, error) {
+	env, err := e.readEnvelope(key)
+	if err != nil || env == nil || env.KeyID == e.keys.CurrentID() {
+		return false, err
+	}
+	dataKey, err := e.keys.Unwrap(env.KeyID, env.DataKey)
+	if err != nil {
+		return false, err
+	}
+	env.KeyID, env.DataKey, err = e.keys.Wrap(dataKey)
+	if err != nil {
+		return false, err
+	}
+	return true, e.putEnvelope(key, *env)
+}
+
+func (e *EncryptedStorage) putEnvelope(key string, env envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	_, err = e.storage.Put(key+ENVELOPE_SUFFIX, bytes.NewReader(data))
+	return err
+}
+
+// readEnvelope 读取文件的数据密钥,没有数据密钥文件时返回nil
+func (e *EncryptedStorage) readEnvelope(key string) (*envelope, error) {
+	r, err := e.storage.Get(key + ENVELOPE_SUFFIX)
+	if errors.Is(err, ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var env envelope
+	if err := json.NewDecoder(io.LimitReader(r, MAX_ENVELOPE_SIZE)).Decode(&env); err != nil {
+		return nil, ErrFileDecryptFailed
+	}
+	if env.Version != ENVELOPE_VERSION || env.ChunkSize <= 0 {
+		return nil, ErrFileDecryptFailed
+	}
+	return &env, nil
+}
+
+// plainSize 根据密文大小计算明文大小,每个分块多出一个认证标签
+func plainSize(sealedTotal int64, chunkSize int) int64 {
+	sealedSize := int64(chunkSize) + GCM_TAG_SIZE
+	chunks := (sealedTotal + sealedSize - 1) / sealedSize
+	return max(0, sealedTotal-chunks*GCM_TAG_SIZE)
+}
+
+// chunkNonce 分块的nonce,前8个字节为分块序号,第9个字节标记是否为最后一块,防止文件被截断
+func chunkNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, index)
+	if final {
+		nonce[8] = 1
+	}
+	return nonce
+}
+
+// chunkWriter 将写入的内容按分块加密,最后一块在Close时写入,空文件也会写入一个空的最后一块
+type chunkWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	size  int
+	buf   []byte
+	out   []byte
+	index uint64
+}
+
+func newChunkWriter(w io.Writer, aead cipher.AEAD, size int) *chunkWriter {
+	return &chunkWriter{
+		w:    w,
+		aead: aead,
+		size: size,
+		buf:  make([]byte, 0, size),
+	}
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// 缓冲区已满并且还有后续内容时,缓冲区中的分块不是最后一块
+		if len(c.buf) == c.size {
+			if err := c.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(c.buf[len(c.buf):c.size], p)
+		c.buf = c.buf[:len(c.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (c *chunkWriter) Close() error {
+	return c.flush(true)
+}
+
+func (c *chunkWriter) flush(final bool) error {
+	c.out = c.aead.Seal(c.out[:0], chunkNonce(c.index, final), c.buf, nil)
+	c.index++
+	c.buf = c.buf[:0]
+	_, err := c.w.Write(c.out)
+	return err
+}
+
+// chunkReader 从指定的分块开始逐块读取并解密
+type chunkReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	index   uint64
+	last    uint64
+	buf     []byte
+	plain   []byte
+	pending []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		if c.index > c.last {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(c.r, c.buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				err = ErrFileDecryptFailed
+			}
+			return 0, err
+		}
+		c.plain, err = c.aead.Open(c.plain[:0], chunkNonce(c.index, c.index == c.last), c.buf[:n], nil)
+		if err != nil {
+			return 0, ErrFileDecryptFailed
+		}
+		c.index++
+		c.pending = c.plain
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
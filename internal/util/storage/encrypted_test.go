@@ -0,0 +1,292 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testChunkSize = 16
+
+func newTestKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestEncrypted 在临时目录上创建加密存储,返回存储和目录
+func newTestEncrypted(t *testing.T, keys ...[]byte) (*EncryptedStorage, string) {
+	t.Helper()
+	dir := t.TempDir()
+	local, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) == 0 {
+		keys = [][]byte{newTestKey(t)}
+	}
+	ring, err := NewKeyRing(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncryptedStorage(local, ring, testChunkSize), dir
+}
+
+func readRange(t *testing.T, storage Storage, key string, offset, length int64) ([]byte, error) {
+	t.Helper()
+	r, err := storage.OpenRange(key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "one byte", size: 1},
+		{name: "less than a chunk", size: testChunkSize - 1},
+		{name: "exactly one chunk", size: testChunkSize},
+		{name: "exact multiple of chunks", size: 4 * testChunkSize},
+		{name: "partial last chunk", size: 4*testChunkSize + 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, dir := newTestEncrypted(t)
+			plain := make([]byte, tt.size)
+			rand.Read(plain)
+
+			n, err := storage.Put("file", bytes.NewReader(plain))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(tt.size) {
+				t.Errorf("Put wrote %d bytes, want %d", n, tt.size)
+			}
+
+			info, err := storage.Stat("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != int64(tt.size) {
+				t.Errorf("Stat size = %d, want %d", info.Size, tt.size)
+			}
+
+			got, err := readRange(t, storage, "file", 0, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("Get returned %d bytes, want %d", len(got), len(plain))
+			}
+
+			// 每个分块多出一个认证标签,空文件也有一个空的最后一块
+			sealed, err := os.ReadFile(filepath.Join(dir, "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := max(1, (tt.size+testChunkSize-1)/testChunkSize)
+			if want := tt.size + chunks*GCM_TAG_SIZE; len(sealed) != want {
+				t.Errorf("sealed size = %d, want %d", len(sealed), want)
+			}
+		})
+	}
+}
+
+func TestEncryptedStorageOpenRange(t *testing.T) {
+	storage, _ := newTestEncrypted(t)
+	plain := make([]byte, 5*testChunkSize+7)
+	rand.Read(plain)
+	if _, err := storage.Put("file", bytes.NewReader(plain)); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(plain))
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           []byte
+	}{
+		{name: "within first chunk", offset: 2, length: 5, want: plain[2:7]},
+		{name: "whole chunk", offset: testChunkSize, length: testChunkSize, want: plain[testChunkSize : 2*testChunkSize]},
+		{name: "across one boundary", offset: testChunkSize - 3, length: 6, want: plain[testChunkSize-3 : testChunkSize+3]},
+		{name: "across several chunks", offset: 5, length: 3 * testChunkSize, want: plain[5 : 5+3*testChunkSize]},
+		{name: "starts at boundary", offset: 2 * testChunkSize, length: 4, want: plain[2*testChunkSize : 2*testChunkSize+4]},
+		{name: "ends at boundary", offset: testChunkSize + 4, length: testChunkSize - 4, want: plain[testChunkSize+4 : 2*testChunkSize]},
+		{name: "last chunk", offset: size - 3, length: 3, want: plain[size-3:]},
+		{name: "to end", offset: 3 * testChunkSize, length: -1, want: plain[3*testChunkSize:]},
+		{name: "past end", offset: size - 2, length: 100, want: plain[size-2:]},
+		{name: "at end", offset: size, length: 10, want: []byte{}},
+		{name: "zero length", offset: 4, length: 0, want: []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRange(t, storage, "file", tt.offset, tt.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("OpenRange(%d, %d) = %x, want %x", tt.offset, tt.length, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedStorageDetectsTampering(t *testing.T) {
+	sealedSize := testChunkSize + GCM_TAG_SIZE
+	tests := []struct {
+		name   string
+		size   int
+		tamper func(sealed []byte) []byte
+	}{
+		{
+			name:   "last chunk removed",
+			size:   3 * testChunkSize,
+			tamper: func(sealed []byte) []byte { return sealed[:2*sealedSize] },
+		},
+		{
+			name:   "truncated inside a chunk",
+			size:   3 * testChunkSize,
+			tamper: func(sealed []byte) []byte { return sealed[:len(sealed)-5] },
+		},
+		{
+			name: "chunks reordered",
+			size: 3 * testChunkSize,
+			tamper: func(sealed []byte) []byte {
+				swapped := append([]byte{}, sealed[sealedSize:2*sealedSize]...)
+				swapped = append(swapped, sealed[:sealedSize]...)
+				return append(swapped, sealed[2*sealedSize:]...)
+			},
+		},
+		{
+			name: "chunk appended",
+			size: 2 * testChunkSize,
+			tamper: func(sealed []byte) []byte {
+				return append(append([]byte{}, sealed...), sealed[:sealedSize]...)
+			},
+		},
+		{
+			name: "byte flipped",
+			size: 2 * testChunkSize,
+			tamper: func(sealed []byte) []byte {
+				sealed[3] ^= 1
+				return sealed
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, dir := newTestEncrypted(t)
+			plain := make([]byte, tt.size)
+			rand.Read(plain)
+			if _, err := storage.Put("file", bytes.NewReader(plain)); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, "file")
+			sealed, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.tamper(sealed), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readRange(t, storage, "file", 0, -1)
+			if !errors.Is(err, ErrFileDecryptFailed) {
+				t.Errorf("read tampered file = %d bytes, %v; want %v", len(got), err, ErrFileDecryptFailed)
+			}
+		})
+	}
+}
+
+func TestEncryptedStoragePlaintextFallback(t *testing.T) {
+	storage, dir := newTestEncrypted(t)
+	// 没有数据密钥文件的旧文件按明文读取
+	if err := os.WriteFile(filepath.Join(dir, "legacy"), []byte("plain content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRange(t, storage, "legacy", 6, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "content" {
+		t.Errorf("legacy read = %q, want %q", got, "content")
+	}
+	rotated, err := storage.Rewrap("legacy")
+	if err != nil || rotated {
+		t.Errorf("Rewrap(legacy) = %v, %v; want false, nil", rotated, err)
+	}
+}
+
+func TestEncryptedStorageRewrap(t *testing.T) {
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	plain := bytes.Repeat([]byte("rewrap me "), 10)
+
+	old, dir := newTestEncrypted(t, oldKey)
+	if _, err := old.Put("file", bytes.NewReader(plain)); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := os.ReadFile(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := func(keys ...[]byte) *EncryptedStorage {
+		ring, err := NewKeyRing(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewEncryptedStorage(local, ring, testChunkSize)
+	}
+
+	// 新的主密钥在第一位,旧的主密钥仍可解密
+	both := open(newKey, oldKey)
+	rotated, err := both.Rewrap("file")
+	if err != nil || !rotated {
+		t.Fatalf("Rewrap = %v, %v; want true, nil", rotated, err)
+	}
+	rotated, err = both.Rewrap("file")
+	if err != nil || rotated {
+		t.Errorf("second Rewrap = %v, %v; want false, nil", rotated, err)
+	}
+	if _, err := both.Rewrap("missing"); err != nil {
+		t.Errorf("Rewrap(missing) = %v, want nil", err)
+	}
+
+	// 文件内容不会重新加密
+	after, err := os.ReadFile(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, sealed) {
+		t.Error("Rewrap changed the encrypted content")
+	}
+
+	// 删除旧的主密钥后仍能读取
+	got, err := readRange(t, open(newKey), "file", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("read after rewrap = %q, want %q", got, plain)
+	}
+	if _, err := readRange(t, open(oldKey), "file", 0, -1); err == nil {
+		t.Error("old master key still decrypts after rewrap")
+	}
+}
@@ -0,0 +1,191 @@
+package util
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+const (
+	MASTER_KEY_SIZE = 32 // AES-256 主密钥的字节数
+	DATA_KEY_SIZE   = 32 // 每个文件的数据密钥的字节数
+)
+
+var (
+	ErrInvalidMasterKey  = errors.New(model.INVALID_MASTER_KEY)
+	ErrMasterKeyNotFound = errors.New(model.MASTER_KEY_NOT_FOUND)
+)
+
+// KeyRing 加密主密钥,第一个用于加密新的数据密钥,其余仅用于解密轮换前的数据密钥
+type KeyRing struct {
+	keys []masterKey
+}
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewKeyRing 根据主密钥创建KeyRing,每个主密钥必须为32字节
+func NewKeyRing(keys [][]byte) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, ErrMasterKeyNotFound
+	}
+	ring := &KeyRing{}
+	for _, key := range keys {
+		if len(key) != MASTER_KEY_SIZE {
+			return nil, ErrInvalidMasterKey
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys = append(ring.keys, masterKey{id: masterKeyID(key), aead: aead})
+	}
+	return ring, nil
+}
+
+// CurrentID 当前用于加密的主密钥ID
+func (k *KeyRing) CurrentID() string {
+	return k.keys[0].id
+}
+
+// Wrap 使用当前主密钥加密数据密钥,返回主密钥ID和加密后的数据密钥
+func (k *KeyRing) Wrap(dataKey []byte) (string, []byte, error) {
+	current := k.keys[0]
+	nonce := make([]byte, current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return current.id, current.aead.Seal(nonce, nonce, dataKey, []byte(current.id)), nil
+}
+
+// Unwrap 使用keyID对应的主密钥解密数据密钥
+func (k *KeyRing) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	for _, key := range k.keys {
+		if key.id != keyID {
+			continue
+		}
+		nonceSize := key.aead.NonceSize()
+		if len(wrapped) < nonceSize {
+			return nil, ErrFileDecryptFailed
+		}
+		dataKey, err := key.aead.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], []byte(keyID))
+		if err != nil {
+			return nil, ErrFileDecryptFailed
+		}
+		return dataKey, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMasterKeyNotFound, keyID)
+}
+
+// masterKeyID 主密钥的标识,取SHA-256的前8个字节,不会泄露主密钥
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateMasterKey 生成base64编码的随机主密钥
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, MASTER_KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadMasterKeys 读取配置中的主密钥,未配置时读取密钥文件
+// 密钥文件不存在时生成新的主密钥并写入密钥文件
+func LoadMasterKeys(encryptionConfig config.EncryptionConfig) ([][]byte, error) {
+	encoded := encryptionConfig.MasterKeys
+	if len(encoded) == 0 {
+		var err error
+		encoded, err = ReadKeyFile(encryptionConfig.KeyFile)
+		if errors.Is(err, os.ErrNotExist) {
+			key, genErr := GenerateMasterKey()
+			if genErr != nil {
+				return nil, genErr
+			}
+			encoded = []string{key}
+			err = WriteKeyFile(encryptionConfig.KeyFile, encoded)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([][]byte, 0, len(encoded))
+	for _, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, ErrInvalidMasterKey
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ReadKeyFile 读取密钥文件,每行一个base64编码的主密钥,忽略空行和#开头的注释
+func ReadKeyFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, scanner.Err()
+}
+
+// WriteKeyFile 写入密钥文件,先写入临时文件再重命名,仅允许当前用户读写
+func WriteKeyFile(path string, keys []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".key_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(strings.Join(keys, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,153 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+// TEMP_FILE_PATTERN 写入过程中的临时文件,进程异常退出时可能残留
+const TEMP_FILE_PATTERN = ".tmp_*"
+
+// LocalStorage 本地磁盘存储
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if root == "" {
+		root = DEFAULT_LOCAL_PATH
+	}
+	// 构建目录
+	if err := ensureDirectoryExists(root); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{
+		root: root,
+	}, nil
+}
+
+// path 将key转换为磁盘路径
+// 旧数据中保存的是 "./share/xxx" 形式的路径,这里只取文件名部分,同时防止路径穿越
+func (l *LocalStorage) path(key string) string {
+	return filepath.Join(l.root, filepath.Base(key))
+}
+
+func (l *LocalStorage) Put(key string, r io.Reader) (int64, error) {
+	// 先写入临时文件再重命名,覆盖已有文件时不会读到不完整的内容
+	dest, err := os.CreateTemp(l.root, TEMP_FILE_PATTERN)
+	if err != nil {
+		return 0, err
+	}
+
+	// 复制文件内容
+	n, err := io.Copy(dest, r)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(dest.Name(), l.path(key))
+	}
+	if err != nil {
+		// 写入失败时删除不完整的文件
+		os.Remove(dest.Name())
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (l *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (l *LocalStorage) Stat(key string) (FileInfo, error) {
+	info, err := os.Stat(l.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return FileInfo{}, ErrFileNotFound
+		}
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (l *LocalStorage) Delete(key string) error {
+	if err := os.Remove(l.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalStorage) OpenRange(key string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+	return &limitReadCloser{
+		Reader: io.LimitReader(file, length),
+		Closer: file,
+	}, nil
+}
+
+// RemoveTempFiles 删除本地存储目录中残留的临时文件,返回删除的文件数
+// 只能在没有进行中的写入时调用,例如启动时或关闭服务时
+func RemoveTempFiles(root string) (int, error) {
+	if root == "" {
+		root = DEFAULT_LOCAL_PATH
+	}
+	matches, err := filepath.Glob(filepath.Join(root, TEMP_FILE_PATTERN))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, match := range matches {
+		if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// limitReadCloser 限制读取长度的同时保留Close方法
+type limitReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func ensureDirectoryExists(dirPath string) error {
+	// 检查并创建目录
+	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(dirPath, 0755); err != nil {
+			return errors.New(model.FILE_DIRECTORY_CREATE)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DISPOSITION_ATTACHMENT = "attachment"
+	DISPOSITION_INLINE     = "inline"
+)
+
+// DetectMimeType 根据文件开头的内容判断MIME类型
+// 内容无法区分的文本和二进制文件(如js、css、docx)再根据扩展名判断
+func DetectMimeType(fileName string, head []byte) string {
+	mimeType := http.DetectContentType(head)
+	if strings.HasPrefix(mimeType, "text/plain") || mimeType == "application/octet-stream" || mimeType == "application/zip" {
+		if byExt := mime.TypeByExtension(filepath.Ext(fileName)); byExt != "" {
+			return byExt
+		}
+	}
+	return mimeType
+}
+
+// IsPreviewable 浏览器可以直接安全展示的类型
+// HTML、SVG等可以执行脚本的类型始终作为附件下载
+func IsPreviewable(mimeType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	switch mediaType {
+	case "text/plain", "application/pdf", "application/json":
+		return true
+	}
+	return false
+}
+
+// ContentDisposition 生成符合 RFC 6266 的 Content-Disposition
+// filename 为只包含ASCII字符的兼容文件名,filename* 为 RFC 5987 编码的UTF-8文件名
+func ContentDisposition(disposition string, fileName string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, fileName)
+	return disposition + `; filename="` + fallback + `"; filename*=UTF-8''` + encodeRFC5987(fileName)
+}
+
+// encodeRFC5987 按 RFC 5987 的 attr-char 编码,url.PathEscape 会保留部分不允许的字符
+func encodeRFC5987(value string) string {
+	escaped := url.PathEscape(value)
+	replacer := strings.NewReplacer("'", "%27", "(", "%28", ")", "%29", "*", "%2A", ",", "%2C",
+		";", "%3B", "=", "%3D", "@", "%40", ":", "%3A", "/", "%2F")
+	return replacer.Replace(escaped)
+}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"mime"
+	"testing"
+)
+
+var pngHead = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDetectMimeType(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		head     []byte
+		want     string
+	}{
+		// 内容可以判断类型时不使用扩展名
+		{name: "png content", fileName: "image.png", head: pngHead, want: "image/png"},
+		{name: "png renamed", fileName: "notes.txt", head: pngHead, want: "image/png"},
+		{name: "html renamed", fileName: "page.txt", head: []byte("<!DOCTYPE html><html>"), want: "text/html; charset=utf-8"},
+		{name: "pdf renamed", fileName: "report.js", head: []byte("%PDF-1.7\n"), want: "application/pdf"},
+		// 文本和二进制内容再根据扩展名判断
+		{name: "javascript", fileName: "app.js", head: []byte("console.log(1)\n"), want: mime.TypeByExtension(".js")},
+		{name: "css", fileName: "style.CSS", head: []byte("body { margin: 0 }"), want: mime.TypeByExtension(".css")},
+		{name: "svg", fileName: "icon.svg", head: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), want: "image/svg+xml"},
+		{name: "wasm", fileName: "app.wasm", head: []byte("\x00asm\x01\x00\x00\x00"), want: "application/wasm"},
+		{name: "binary without extension", fileName: "blob", head: []byte{0x00, 0x01, 0x02, 0xff}, want: "application/octet-stream"},
+		{name: "text without extension", fileName: "README", head: []byte("hello"), want: "text/plain; charset=utf-8"},
+		{name: "zip unknown extension", fileName: "archive.unknownext", head: []byte("PK\x03\x04"), want: "application/zip"},
+		{name: "empty file", fileName: "empty.json", head: nil, want: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectMimeType(tt.fileName, tt.head); got != tt.want {
+				t.Errorf("DetectMimeType(%q) = %q, want %q", tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPreviewable(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     bool
+	}{
+		{mimeType: "image/png", want: true},
+		{mimeType: "image/jpeg", want: true},
+		{mimeType: "video/mp4", want: true},
+		{mimeType: "audio/mpeg", want: true},
+		{mimeType: "text/plain; charset=utf-8", want: true},
+		{mimeType: "application/pdf", want: true},
+		{mimeType: "application/json", want: true},
+		// 可以执行脚本的类型只能作为附件下载
+		{mimeType: "image/svg+xml", want: false},
+		{mimeType: "IMAGE/SVG+XML", want: false},
+		{mimeType: "text/html; charset=utf-8", want: false},
+		{mimeType: "application/xhtml+xml", want: false},
+		{mimeType: "text/javascript; charset=utf-8", want: false},
+		{mimeType: "application/octet-stream", want: false},
+		{mimeType: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsPreviewable(tt.mimeType); got != tt.want {
+			t.Errorf("IsPreviewable(%q) = %v, want %v", tt.mimeType, got, tt.want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition string
+		fileName    string
+		want        string
+	}{
+		{
+			name:        "ascii",
+			disposition: DISPOSITION_ATTACHMENT,
+			fileName:    "report.pdf",
+			want:        `attachment; filename="report.pdf"; filename*=UTF-8''report.pdf`,
+		},
+		{
+			name:        "unicode",
+			disposition: DISPOSITION_INLINE,
+			fileName:    "报告.pdf",
+			want:        `inline; filename="__.pdf"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`,
+		},
+		{
+			name:        "quotes and backslash",
+			disposition: DISPOSITION_ATTACHMENT,
+			fileName:    `a"b\c.txt`,
+			want:        `attachment; filename="a_b_c.txt"; filename*=UTF-8''a%22b%5Cc.txt`,
+		},
+		{
+			name:        "header separators",
+			disposition: DISPOSITION_ATTACHMENT,
+			fileName:    "a;b=c,d (1)'*.txt",
+			want:        `attachment; filename="a;b=c,d (1)'*.txt"; filename*=UTF-8''a%3Bb%3Dc%2Cd%20%281%29%27%2A.txt`,
+		},
+		{
+			name:        "control characters",
+			disposition: DISPOSITION_ATTACHMENT,
+			fileName:    "a\r\nb.txt",
+			want:        `attachment; filename="a__b.txt"; filename*=UTF-8''a%0D%0Ab.txt`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ContentDisposition(tt.disposition, tt.fileName)
+			if got != tt.want {
+				t.Errorf("ContentDisposition(%q) = %s, want %s", tt.fileName, got, tt.want)
+			}
+			// 解析后得到原文件名
+			disposition, params, err := mime.ParseMediaType(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if disposition != tt.disposition || params["filename"] != tt.fileName {
+				t.Errorf("parsed %s filename=%q, want %s filename=%q", disposition, params["filename"], tt.disposition, tt.fileName)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/WindyDante/toolpost/internal/config"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3_PART_SIZE 分片上传时每个分片的大小,上传时需要在内存中缓冲一个分片
+// 大小未知时minio默认按最大对象大小计算分片,每次上传会分配约550MB的缓冲区
+// 16MB的分片在10000个分片的限制下最大支持约156GB的文件
+const S3_PART_SIZE = 16 * 1024 * 1024
+
+// S3Storage 兼容S3协议的对象存储(AWS S3、MinIO等)
+type S3Storage struct {
+	client        *minio.Client
+	bucket        string
+	presignExpire time.Duration
+}
+
+func NewS3Storage(s3Config config.S3StorageConfig) (*S3Storage, error) {
+	client, err := minio.New(s3Config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(s3Config.AccessKey, s3Config.SecretKey, ""),
+		Secure: s3Config.UseSSL,
+		Region: s3Config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 存储桶不存在时自动创建
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, s3Config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, s3Config.Bucket, minio.MakeBucketOptions{Region: s3Config.Region}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3Storage{
+		client:        client,
+		bucket:        s3Config.Bucket,
+		presignExpire: time.Duration(s3Config.PresignExpire) * time.Second,
+	}, nil
+}
+
+func (s *S3Storage) Put(key string, r io.Reader) (int64, error) {
+	// 大小未知时使用分片上传,指定分片大小以限制内存占用
+	info, err := s.client.PutObject(context.Background(), s.bucket, key, r, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    S3_PART_SIZE,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (s *S3Storage) Get(key string) (io.ReadCloser, error) {
+	return s.OpenRange(key, 0, -1)
+}
+
+func (s *S3Storage) Stat(key string) (FileInfo, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return FileInfo{}, convertS3Error(err)
+	}
+	return FileInfo{
+		Key:     key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+	}, nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	// 对象不存在时S3同样返回成功
+	return s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) OpenRange(key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length == 0:
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	case length > 0:
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, err
+		}
+	case offset > 0:
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, opts)
+	if err != nil {
+		return nil, convertS3Error(err)
+	}
+	// GetObject 是惰性请求,这里通过Stat提前暴露对象不存在等错误
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, convertS3Error(err)
+	}
+	return object, nil
+}
+
+// PresignGet 生成预签名下载链接,presignExpire 为 0 时不使用预签名链接
+func (s *S3Storage) PresignGet(key, disposition, contentType string) (string, error) {
+	if s.presignExpire <= 0 {
+		return "", nil
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", disposition)
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	u, err := s.client.PresignedGetObject(context.Background(), s.bucket, key, s.presignExpire, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// convertS3Error 将对象不存在的错误转换为 ErrFileNotFound
+func convertS3Error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrFileNotFound
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"errors"
+	"io"
+
+	model "github.com/WindyDante/toolpost/internal/model/common"
+)
+
+var errInvalidSeek = errors.New(model.INVALID_SEEK_OFFSET)
+
+// rangeReadSeeker 基于 OpenRange 实现可随机读取的文件,适用于所有存储
+// Seek 只记录新的位置,下一次读取时再从该位置打开,连续读取时复用同一个连接
+type rangeReadSeeker struct {
+	storage Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+// NewReadSeeker 创建可随机读取的文件,用于 Range 请求
+func NewReadSeeker(storage Storage, key string, size int64) io.ReadSeekCloser {
+	return &rangeReadSeeker{
+		storage: storage,
+		key:     key,
+		size:    size,
+	}
+}
+
+func (r *rangeReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.storage.OpenRange(r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errInvalidSeek
+	}
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *rangeReadSeeker) Close() error {
+	return r.closeBody()
+}
+
+func (r *rangeReadSeeker) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -1,108 +1,186 @@
 package util
 
 import (
-	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/WindyDante/toolpost/internal/config"
 	model "github.com/WindyDante/toolpost/internal/model/common"
 )
 
 const (
-	DIRECTORY_PATH = "./share"
+	STORAGE_TYPE_LOCAL = "local"
+	STORAGE_TYPE_S3    = "s3"
+	DEFAULT_LOCAL_PATH = "./share"
+	SNIFF_LENGTH       = 512 // 判断文件类型时读取的字节数,与 http.DetectContentType 一致
 )
 
-// 计算文件 MD5 值的辅助函数
-func CalculateFileMD5(fileHeader *multipart.FileHeader) (string, error) {
-	// 打开文件
-	file, err := fileHeader.Open()
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
+var (
+	ErrFileNotFound        = errors.New(model.FILE_NOT_FOUND)
+	ErrFileMaxSizeExceeded = errors.New(model.FILE_MAX_SIZE_EXCEEDED)
+)
+
+// FileInfo 存储中文件的元信息
+type FileInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
 
-	// 创建 MD5 哈希
-	hash := md5.New()
+// Storage 文件存储后端,所有对文件的读写都通过该接口完成
+type Storage interface {
+	// 写入文件,返回写入的字节数
+	Put(key string, r io.Reader) (int64, error)
 
-	// 将文件内容拷贝到哈希计算器中
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
-	}
+	// 读取整个文件
+	Get(key string) (io.ReadCloser, error)
+
+	// 获取文件元信息,文件不存在时返回 ErrFileNotFound
+	Stat(key string) (FileInfo, error)
+
+	// 删除文件,文件不存在时不报错
+	Delete(key string) error
 
-	// 计算 MD5 值并转换为十六进制字符串
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	// 从 offset 开始读取 length 个字节,length 小于 0 表示读到文件末尾
+	OpenRange(key string, offset, length int64) (io.ReadCloser, error)
 }
 
-func UploadFile(file *multipart.FileHeader) (string, error) {
-	if file == nil {
-		return "", errors.New(model.NO_FILE_UPLOAD)
+// Presigner 支持生成预签名下载链接的存储后端,下载时直接重定向到存储而不经过服务端
+type Presigner interface {
+	// 生成带Content-Disposition和Content-Type的预签名链接,返回空字符串表示不使用预签名链接
+	PresignGet(key, disposition, contentType string) (string, error)
+}
+
+// NewStorage 根据配置创建对应的存储后端,开启加密时在存储后端之上加密文件内容
+func NewStorage() (Storage, error) {
+	storage, err := NewBackend()
+	if err != nil || !config.Config.Encryption.Enabled {
+		return storage, err
 	}
-	return UploadFileToLocal(file)
+	return NewEncryptedStorageFromConfig(storage)
 }
 
-func UploadFileToLocal(file *multipart.FileHeader) (string, error) {
-	// 构建目录
-	if err := ensureDirectoryExists(DIRECTORY_PATH); err != nil {
-		return "", err
+// NewEncryptedStorageFromConfig 使用配置中的主密钥加密存储后端中的文件
+func NewEncryptedStorageFromConfig(storage Storage) (*EncryptedStorage, error) {
+	keys, err := LoadMasterKeys(config.Config.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	ring, err := NewKeyRing(keys)
+	if err != nil {
+		return nil, err
 	}
+	return NewEncryptedStorage(storage, ring, config.Config.Encryption.ChunkSize), nil
+}
 
-	// 保存文件
-	url, err := saveUploadFile(file)
+// NewLocalScratch 保存服务端生成的本地数据,如缩略图缓存和未完成的断点续传分片
+// 开启加密时与文件存储使用相同的主密钥加密,不在磁盘上留下明文
+func NewLocalScratch(dir string) (Storage, error) {
+	local, err := NewLocalStorage(dir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	if !config.Config.Encryption.Enabled {
+		return local, nil
+	}
+	return NewEncryptedStorageFromConfig(local)
+}
 
-	return url, nil
+// NewBackend 根据配置创建不加密的存储后端
+func NewBackend() (Storage, error) {
+	storageConfig := config.Config.Storage
+	switch storageConfig.Type {
+	case STORAGE_TYPE_LOCAL, "":
+		return NewLocalStorage(storageConfig.Local.Path)
+	case STORAGE_TYPE_S3:
+		return NewS3Storage(storageConfig.S3)
+	default:
+		return nil, errors.New(model.STORAGE_TYPE_UNSUPPORTED + ": " + storageConfig.Type)
+	}
 }
 
-func saveUploadFile(file *multipart.FileHeader) (string, error) {
-	// 生成随机ID
-	uuid := UUID()
+// StoredFile 写入存储后的文件信息
+type StoredFile struct {
+	Key      string // 文件在存储中的key
+	FileName string // 原文件名
+	MimeType string // 根据内容和扩展名判断的MIME类型
+	Size     int64  // 文件大小
+	SHA256   string // 十六进制的 SHA-256 值
+}
 
-	// 获取文件拓展名
-	ext := filepath.Ext(file.Filename)
-	// 移除对应的文件后缀名,获得纯文件名
-	nameWithoutExt := strings.TrimSuffix(file.Filename, ext)
-	fileName := fmt.Sprintf("%s_%s%s", nameWithoutExt, uuid, ext)
-	filePath := filepath.Join(DIRECTORY_PATH, fileName)
+// UploadStream 将文件流写入存储,写入的同时计算哈希值
+// 文件超过 maxSize 时中断写入并删除已写入的部分,返回 ErrFileMaxSizeExceeded
+func UploadStream(storage Storage, fileName string, r io.Reader, maxSize int64) (StoredFile, error) {
+	sha256Hash := sha256.New()
+	head := &headWriter{}
+	limited := &sizeLimitReader{r: r, max: maxSize}
 
-	// 打开上传的文件
-	src, err := file.Open()
+	key := GenerateFileKey(fileName)
+	size, err := storage.Put(key, io.TeeReader(limited, io.MultiWriter(sha256Hash, head)))
 	if err != nil {
-		return "", err
+		storage.Delete(key)
+		if limited.exceeded {
+			return StoredFile{}, ErrFileMaxSizeExceeded
+		}
+		return StoredFile{}, err
 	}
-	defer src.Close()
 
-	// 创建目标文件
-	dest, err := os.Create(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer dest.Close()
+	return StoredFile{
+		Key:      key,
+		FileName: filepath.Base(fileName),
+		MimeType: DetectMimeType(fileName, head.buf),
+		Size:     size,
+		SHA256:   hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
+}
 
-	// 复制文件内容
-	if _, err := io.Copy(dest, src); err != nil {
-		return "", err
+// headWriter 保存写入内容的前 SNIFF_LENGTH 个字节,用于判断文件类型
+type headWriter struct {
+	buf []byte
+}
+
+func (h *headWriter) Write(p []byte) (int, error) {
+	if remain := SNIFF_LENGTH - len(h.buf); remain > 0 {
+		h.buf = append(h.buf, p[:min(remain, len(p))]...)
 	}
+	return len(p), nil
+}
 
-	// 返回文件的相对路径
-	return fmt.Sprintf("%s/%s", DIRECTORY_PATH, fileName), nil
+// sizeLimitReader 读取超过 max 字节时返回错误,用于在写入过程中限制文件大小
+type sizeLimitReader struct {
+	r        io.Reader
+	max      int64
+	read     int64
+	exceeded bool
 }
 
-func ensureDirectoryExists(dirPath string) error {
-	// 检查并创建目录
-	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(dirPath, 0755); err != nil {
-			return errors.New(model.FILE_DIRECTORY_CREATE)
-		}
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		l.exceeded = true
+		return n, ErrFileMaxSizeExceeded
 	}
-	return nil
+	return n, err
+}
+
+// GenerateFileKey 根据原文件名生成存储key
+// 例如: "template.html" -> "template_26aad675.html"
+func GenerateFileKey(fileName string) string {
+	// 只保留文件名部分,防止路径穿越
+	fileName = filepath.Base(fileName)
+	// 获取文件拓展名
+	ext := filepath.Ext(fileName)
+	// 移除对应的文件后缀名,获得纯文件名
+	nameWithoutExt := strings.TrimSuffix(fileName, ext)
+	return fmt.Sprintf("%s_%s%s", nameWithoutExt, UUID(), ext)
 }
 
 func UUID() string {
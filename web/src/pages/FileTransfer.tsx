@@ -94,19 +94,19 @@ const FileTransfer = () => {
     return labelMap[timeValue] || "24小时";
   };
 
-  const getExpirationValues = (timeValue: string) => {
-    // 将前端时间格式转换为后端需要的 expireTime 和 expireUnit
-    const valueMap: { [key: string]: { expireTime: number, expireUnit: number } } = {
-      "1h": { expireTime: 1, expireUnit: 3600 },     // 1小时，单位秒
-      "6h": { expireTime: 6, expireUnit: 3600 },     // 6小时，单位秒
-      "12h": { expireTime: 12, expireUnit: 3600 },   // 12小时，单位秒
-      "24h": { expireTime: 24, expireUnit: 3600 },   // 24小时，单位秒
-      "48h": { expireTime: 48, expireUnit: 3600 },   // 48小时，单位秒
-      "72h": { expireTime: 72, expireUnit: 3600 },   // 72小时，单位秒
-      "7d": { expireTime: 7, expireUnit: 86400 },    // 7天，单位秒（1天=86400秒）
-      "30d": { expireTime: 30, expireUnit: 86400 },  // 30天，单位秒
+  const getExpirationValue = (timeValue: string) => {
+    // 将前端时间格式转换为后端需要的 ISO-8601 有效时长
+    const valueMap: { [key: string]: string } = {
+      "1h": "PT1H",
+      "6h": "PT6H",
+      "12h": "PT12H",
+      "24h": "PT24H",
+      "48h": "PT48H",
+      "72h": "PT72H",
+      "7d": "P7D",
+      "30d": "P30D",
     };
-    return valueMap[timeValue] || { expireTime: 24, expireUnit: 3600 };
+    return valueMap[timeValue] || "PT24H";
   };
 
   const generateRandomCode = () => {
@@ -396,9 +396,7 @@ const FileTransfer = () => {
       }
 
       // 处理过期时间
-      const { expireTime, expireUnit } = getExpirationValues(expirationTime);
-      formData.append('expireTime', expireTime.toString());
-      formData.append('expireUnit', expireUnit.toString());
+      formData.append('expire', getExpirationValue(expirationTime));
 
       // 调用后端API
       const response = await fetch('http://localhost:6332/api/upload', {